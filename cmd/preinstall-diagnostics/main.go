@@ -2,16 +2,22 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"time"
 
 	"github.com/run-ai/preinstall-diagnostics/internal/cmd/cli"
 	"github.com/run-ai/preinstall-diagnostics/internal/cmd/job"
 
+	"github.com/run-ai/preinstall-diagnostics/internal/egress"
 	"github.com/run-ai/preinstall-diagnostics/internal/env"
 	"github.com/run-ai/preinstall-diagnostics/internal/log"
+	"github.com/run-ai/preinstall-diagnostics/internal/mesh"
+	"github.com/run-ai/preinstall-diagnostics/internal/probe"
 	"github.com/run-ai/preinstall-diagnostics/internal/registry"
 	"github.com/run-ai/preinstall-diagnostics/internal/resources"
 	"github.com/run-ai/preinstall-diagnostics/internal/saas"
+	v1 "k8s.io/api/core/v1"
 )
 
 const (
@@ -26,10 +32,42 @@ const (
 	outputArgName                 = "output"
 	versionArgName                = "version"
 	airgappedArgName              = "airgapped"
+	namespaceArgName              = "namespace"
+	namePrefixArgName             = "name-prefix"
+	useExistingNamespaceArgName   = "use-existing-namespace"
+	staleRunTTLArgName            = "stale-run-ttl"
+	waitForLockArgName            = "wait-for-lock"
+	agentRequestsArgName          = "agent-requests"
+	agentLimitsArgName            = "agent-limits"
+	priorityClassArgName          = "priority-class"
+	imagePullPolicyArgName        = "image-pull-policy"
+	proxyArgName                  = "proxy"
+	noProxyArgName                = "no-proxy"
+	caBundleArgName               = "ca-bundle"
+	endpointsArgName              = "endpoints"
+	endpointSampleSizeArgName     = "endpoint-sample-size"
+	tcpTargetsArgName             = "tcp-targets"
+	udpTargetsArgName             = "udp-targets"
+	meshSampleArgName             = "mesh-sample"
+	clockSkewWarnArgName          = "clock-skew-warn"
+	clockSkewFailArgName          = "clock-skew-fail"
+	hostNetworkArgName            = "host-network"
+	inspectHostsArgName           = "inspect-hosts"
+	throughputArgName             = "throughput"
+	throughputDurationArgName     = "throughput-duration"
+	throughputPairsArgName        = "throughput-pairs"
 )
 
 const (
 	defaultOutputFileName = "runai-diagnostics.txt"
+	defaultStaleRunTTL    = time.Hour
+	defaultAgentRequests  = "cpu=50m,memory=64Mi"
+	defaultAgentLimits    = "cpu=500m,memory=256Mi"
+	defaultSampleSize     = 3
+	// The CLI waits for the agents for as long as the throughput tests of the
+	// busiest node take, bounded to keep runs short
+	defaultThroughputDuration = 10 * time.Second
+	maxThroughputDuration     = time.Minute
 )
 
 var (
@@ -45,6 +83,30 @@ var (
 	output                  string
 	version                 bool
 	airgapped               bool
+	namespace               string
+	namePrefix              string
+	useExistingNamespace    bool
+	staleRunTTL             time.Duration
+	waitForLock             time.Duration
+	agentRequests           string
+	agentLimits             string
+	priorityClass           string
+	imagePullPolicy         string
+	proxy                   string
+	noProxy                 string
+	caBundlePath            string
+	endpointsPath           string
+	endpointSampleSize      int
+	tcpTargets              string
+	udpTargets              string
+	meshSample              int
+	clockSkewWarn           time.Duration
+	clockSkewFail           time.Duration
+	hostNetwork             bool
+	inspectHosts            bool
+	throughput              bool
+	throughputDuration      time.Duration
+	throughputPairs         string
 	outputFile              *os.File
 )
 
@@ -52,17 +114,43 @@ func init() {
 	runInternalClusterTestsStr, _ := env.EnvOrError(resources.RunInternalClusterTestsEnvVarName)
 	runInternalClusterTests = runInternalClusterTestsStr != ""
 
-	flag.BoolVar(&clean, cleanArgName, false, "Clean all runai diagnostics tools from the cluster")
+	flag.BoolVar(&clean, cleanArgName, false, "Clean runai diagnostics runs older than --stale-run-ttl from the cluster")
 	flag.StringVar(&backendDomainFQDN, backendDomainArgName, "", "FQDN of the runai backend to resolve (required for DNS resolve test)")
 	flag.StringVar(&clusterDomainFQDN, clusterDomainArgName, "", "FQDN of the cluster")
 	flag.StringVar(&image, imageArgName, registry.RunAIDiagnosticsImage, "Diagnostics image to use (for air-gapped environments)")
-	flag.StringVar(&imagePullSecretName, imagePullSecretArgName, "", "Secret name (within the 'runai-diagnostics' namespace) that contains container-registry credentials")
+	flag.StringVar(&imagePullSecretName, imagePullSecretArgName, "", "Secret name (within the diagnostics namespace) that contains container-registry credentials")
 	flag.BoolVar(&dryRun, dryRunArgName, false, "Print the diagnostics resources without executing")
 	flag.StringVar(&runaiContainerRegistry, runaiContainerRegistryArgName, registry.RunAIProdRegistryURL, "URL to container image registry to check connectivity to")
 	flag.StringVar(&runaiSaas, runaiSaasArgName, saas.RunAISaasAddress, "URL the Run:AI service to check connectivity to")
 	flag.StringVar(&output, outputArgName, defaultOutputFileName, "File to save the output to")
 	flag.BoolVar(&version, versionArgName, false, "Prints the binary version")
 	flag.BoolVar(&airgapped, airgappedArgName, false, "skip tests that require network access")
+	flag.StringVar(&namespace, namespaceArgName, resources.DefaultNamespace, "Namespace to deploy the diagnostics resources to")
+	flag.StringVar(&namePrefix, namePrefixArgName, resources.DefaultNamePrefix, "Prefix of the names of all diagnostics resources")
+	flag.BoolVar(&useExistingNamespace, useExistingNamespaceArgName, false, "Deploy to an existing namespace without creating or labelling it")
+	flag.DurationVar(&staleRunTTL, staleRunTTLArgName, defaultStaleRunTTL, "Age after which resources left by previous runs are considered stale and deleted")
+	flag.DurationVar(&waitForLock, waitForLockArgName, 0, "How long to wait for another active run to finish instead of refusing to start")
+	flag.StringVar(&agentRequests, agentRequestsArgName, defaultAgentRequests, "Resource requests of the diagnostics agents")
+	flag.StringVar(&agentLimits, agentLimitsArgName, defaultAgentLimits, "Resource limits of the diagnostics agents")
+	flag.StringVar(&priorityClass, priorityClassArgName, "", "PriorityClass of the diagnostics agents")
+	flag.StringVar(&imagePullPolicy, imagePullPolicyArgName, string(v1.PullIfNotPresent), "Pull policy of the diagnostics image (Always, IfNotPresent or Never)")
+	defaultProxy, defaultNoProxy := probe.ProxyFromEnv()
+	flag.StringVar(&proxy, proxyArgName, defaultProxy, "HTTP(S) proxy used by the connectivity checks, from the CLI and the agents")
+	flag.StringVar(&noProxy, noProxyArgName, defaultNoProxy, "Comma separated destinations which are not reached through the proxy")
+	flag.StringVar(&caBundlePath, caBundleArgName, "", "PEM file of CA certificates to trust in HTTPS checks, e.g. of a TLS-inspecting proxy")
+	flag.StringVar(&endpointsPath, endpointsArgName, "", "YAML file listing the egress endpoints to check instead of the Run:ai defaults")
+	flag.IntVar(&endpointSampleSize, endpointSampleSizeArgName, defaultSampleSize, "Number of nodes checking the endpoints with the 'sample' scope")
+	flag.StringVar(&tcpTargets, tcpTargetsArgName, "", "Comma separated host:port addresses every node should reach over TCP, e.g. nfs.my-org.com:2049")
+	flag.StringVar(&udpTargets, udpTargetsArgName, "", "Comma separated host:port addresses every node should get a UDP response from, e.g. 10.0.0.2:53,ntp.my-org.com:123")
+	flag.IntVar(&meshSample, meshSampleArgName, 0, "Number of peers every node pings instead of all nodes, for large clusters")
+	defaultClockSkew := mesh.DefaultClockSkewThresholds()
+	flag.DurationVar(&clockSkewWarn, clockSkewWarnArgName, defaultClockSkew.Warn, "Clock offset between nodes, or with the API server, reported as a warning")
+	flag.DurationVar(&clockSkewFail, clockSkewFailArgName, defaultClockSkew.Fail, "Clock offset between nodes, or with the API server, reported as a failure")
+	flag.BoolVar(&hostNetwork, hostNetworkArgName, false, "Also run the network checks from host network agents, to tell CNI issues from host issues (requires the privileged pod security level)")
+	flag.BoolVar(&inspectHosts, inspectHostsArgName, false, "Inspect the kernel, sysctls and disk space of the nodes through read-only hostPath mounts (requires the privileged pod security level)")
+	flag.BoolVar(&throughput, throughputArgName, false, "Measure the TCP throughput between pairs of nodes")
+	flag.DurationVar(&throughputDuration, throughputDurationArgName, defaultThroughputDuration, "Duration of every throughput test (at most 1m)")
+	flag.StringVar(&throughputPairs, throughputPairsArgName, "", "Comma separated source:target node pairs to measure the throughput of, every node sends to one other node when empty")
 	flag.Parse()
 }
 
@@ -83,7 +171,128 @@ func main() {
 
 		logger := log.NewLogger(outputFile)
 
-		cli.Main(clean, dryRun, backendDomainFQDN, clusterDomainFQDN, image,
-			imagePullSecretName, runaiContainerRegistry, runaiSaas, version, airgapped, logger)
+		agentResources, err := agentResourceRequirements()
+		if err != nil {
+			_, _ = logger.WriteStringF("%v", err)
+			os.Exit(1)
+		}
+
+		var caBundle []byte
+		if caBundlePath != "" {
+			caBundle, err = os.ReadFile(caBundlePath)
+			if err != nil {
+				_, _ = logger.WriteStringF("could not read --%s: %v", caBundleArgName, err)
+				os.Exit(1)
+			}
+		}
+
+		// air-gapped clusters cannot reach the public Run:ai endpoints, the
+		// endpoints and port targets given by the user are still checked
+		endpoints := egress.DefaultEndpoints(runaiSaas)
+		if airgapped {
+			endpoints = []egress.Endpoint{}
+		}
+		if endpointsPath != "" {
+			endpoints, err = egress.LoadEndpoints(endpointsPath)
+			if err != nil {
+				_, _ = logger.WriteStringF("invalid --%s: %v", endpointsArgName, err)
+				os.Exit(1)
+			}
+		}
+
+		for _, target := range []struct {
+			argName   string
+			protocol  egress.Protocol
+			addresses string
+		}{
+			{tcpTargetsArgName, egress.ProtocolTCP, tcpTargets},
+			{udpTargetsArgName, egress.ProtocolUDP, udpTargets},
+		} {
+			portTargets, err := egress.PortTargets(target.protocol, target.addresses)
+			if err != nil {
+				_, _ = logger.WriteStringF("invalid --%s: %v", target.argName, err)
+				os.Exit(1)
+			}
+			endpoints = append(endpoints, portTargets...)
+		}
+
+		if meshSample < 0 {
+			_, _ = logger.WriteStringF("invalid --%s %d", meshSampleArgName, meshSample)
+			os.Exit(1)
+		}
+
+		if clockSkewWarn <= 0 || clockSkewFail < clockSkewWarn {
+			_, _ = logger.WriteStringF("invalid --%s %s and --%s %s, the failure threshold must not be lower than the warning one",
+				clockSkewWarnArgName, clockSkewWarn, clockSkewFailArgName, clockSkewFail)
+			os.Exit(1)
+		}
+
+		if throughputDuration <= 0 || throughputDuration > maxThroughputDuration {
+			_, _ = logger.WriteStringF("invalid --%s %s, must be positive and at most %s",
+				throughputDurationArgName, throughputDuration, maxThroughputDuration)
+			os.Exit(1)
+		}
+
+		throughputTargets, err := mesh.ParseNodePairs(throughputPairs)
+		if err != nil {
+			_, _ = logger.WriteStringF("invalid --%s: %v", throughputPairsArgName, err)
+			os.Exit(1)
+		}
+
+		switch v1.PullPolicy(imagePullPolicy) {
+		case v1.PullAlways, v1.PullIfNotPresent, v1.PullNever:
+		default:
+			_, _ = logger.WriteStringF("invalid --%s %q", imagePullPolicyArgName, imagePullPolicy)
+			os.Exit(1)
+		}
+
+		cli.Main(clean, dryRun, clusterDomainFQDN, resources.TemplateOptions{
+			BackendFQDN:         backendDomainFQDN,
+			Image:               image,
+			ImagePullSecretName: imagePullSecretName,
+			ImageRegistry:       runaiContainerRegistry,
+			RunAISaas:           runaiSaas,
+			Airgapped:           airgapped,
+			AgentResources:      agentResources,
+			PriorityClassName:   priorityClass,
+			ImagePullPolicy:     v1.PullPolicy(imagePullPolicy),
+			Proxy:               proxy,
+			NoProxy:             noProxy,
+			CABundle:            caBundle,
+			Endpoints:           endpoints,
+			EndpointSampleSize:  endpointSampleSize,
+			MeshSampleSize:      meshSample,
+			HostNetwork:         hostNetwork,
+			HostInspection:      inspectHosts,
+			Throughput:          throughput,
+			ThroughputDuration:  throughputDuration,
+			ThroughputPairs:     throughputTargets,
+			ClockSkew: mesh.ClockSkewThresholds{
+				Warn: clockSkewWarn,
+				Fail: clockSkewFail,
+			},
+			Names: resources.Names{
+				Namespace: namespace,
+				Prefix:    namePrefix,
+			},
+			UseExistingNamespace: useExistingNamespace,
+		}, staleRunTTL, waitForLock, version, logger)
 	}
 }
+
+func agentResourceRequirements() (v1.ResourceRequirements, error) {
+	requests, err := resources.ParseResourceList(agentRequests)
+	if err != nil {
+		return v1.ResourceRequirements{}, fmt.Errorf("invalid --%s: %v", agentRequestsArgName, err)
+	}
+
+	limits, err := resources.ParseResourceList(agentLimits)
+	if err != nil {
+		return v1.ResourceRequirements{}, fmt.Errorf("invalid --%s: %v", agentLimitsArgName, err)
+	}
+
+	return v1.ResourceRequirements{
+		Requests: requests,
+		Limits:   limits,
+	}, nil
+}
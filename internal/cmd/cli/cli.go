@@ -5,24 +5,32 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/jedib0t/go-pretty/v6/table"
 	v2 "github.com/run-ai/preinstall-diagnostics/internal"
+	"github.com/run-ai/preinstall-diagnostics/internal/external-cluster-tests"
 	"github.com/run-ai/preinstall-diagnostics/internal/k8sclient"
 	"github.com/run-ai/preinstall-diagnostics/internal/log"
+	"github.com/run-ai/preinstall-diagnostics/internal/mesh"
+	"github.com/run-ai/preinstall-diagnostics/internal/probe"
+	"github.com/run-ai/preinstall-diagnostics/internal/progress"
 	"github.com/run-ai/preinstall-diagnostics/internal/resources"
 	"github.com/run-ai/preinstall-diagnostics/internal/utils"
 	ver "github.com/run-ai/preinstall-diagnostics/internal/version"
+	v1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/azure"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/oidc"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-func Main(clean, dryRun bool, backendFQDN, clusterFQDN, image, imagePullSecretName, imageRegistry,
-	runaiSaas string, version bool, airgapped bool, logger *log.Logger) {
-	if airgapped {
+func Main(clean, dryRun bool, clusterFQDN string, templateOpts resources.TemplateOptions,
+	staleRunTTL, lockWait time.Duration, version bool, logger *log.Logger) {
+	if templateOpts.Airgapped {
 		fmt.Println("airgapped")
 	}
 	if version {
@@ -30,8 +38,38 @@ func Main(clean, dryRun bool, backendFQDN, clusterFQDN, image, imagePullSecretNa
 		return
 	}
 
-	creationOrder, deletionOrder := resources.TemplateResources(backendFQDN, image,
-		imagePullSecretName, imageRegistry, runaiSaas, airgapped)
+	probe.SetProxy(templateOpts.Proxy, templateOpts.NoProxy)
+	if len(templateOpts.CABundle) > 0 {
+		err := probe.SetCABundle(templateOpts.CABundle)
+		if err != nil {
+			_, _ = logger.WriteStringF("invalid CA bundle: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	templateOpts.Names.RunID = resources.NewRunID()
+	names := templateOpts.Names
+
+	openShift, _, err := external_cluster_tests.IsOpenShift()
+	if err != nil {
+		panic(err)
+	}
+	templateOpts.OpenShift = openShift
+
+	nodeNames, zones, err := clusterNodes()
+	if err != nil {
+		panic(err)
+	}
+
+	if templateOpts.Throughput {
+		unknown := mesh.UnknownNodes(templateOpts.ThroughputPairs, nodeNames)
+		if len(unknown) > 0 {
+			_, _ = logger.WriteStringF("invalid throughput pairs, no such nodes: %s", strings.Join(unknown, ", "))
+			os.Exit(1)
+		}
+	}
+
+	creationOrder := resources.TemplateResources(templateOpts)
 
 	if dryRun {
 		err := resources.PrintResources(creationOrder)
@@ -52,20 +90,62 @@ func Main(clean, dryRun bool, backendFQDN, clusterFQDN, image, imagePullSecretNa
 	//	panic(err)
 	//}
 
-	_, _ = logger.WriteStringF("cleaning up previous deployment if it exists...")
-	err = utils.DeleteResources(deletionOrder, dynClient, logger)
+	if clean {
+		activeRunID, err := resources.ActiveRun(names)
+		if err != nil {
+			panic(err)
+		}
+
+		_, _ = logger.WriteStringF("cleaning up runs older than %s...", staleRunTTL)
+		err = utils.DeleteStaleRuns(names, staleRunTTL, activeRunID, dynClient, logger)
+		if err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	if templateOpts.UseExistingNamespace {
+		exists, err := resources.NamespaceExists(names.Namespace)
+		if err != nil {
+			panic(err)
+		}
+
+		if !exists {
+			_, _ = logger.WriteStringF("namespace %s does not exist, it must be created before using an existing namespace",
+				names.Namespace)
+			os.Exit(1)
+		}
+	} else {
+		err = utils.CreateResources([]client.Object{resources.TemplateNamespace(names, templateOpts.PodSecurityLevel())}, dynClient)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	_, _ = logger.WriteStringF("acquiring the diagnostics lock for run %s...", names.RunID)
+	lock, err := resources.AcquireRunLock(names, lockWait, logger)
 	if err != nil {
-		panic(err)
+		_, _ = logger.WriteStringF("%v, wait for it to finish or use --wait-for-lock", err)
+		os.Exit(1)
 	}
+	defer func() {
+		_ = lock.Release()
+	}()
 
-	if clean {
-		return
+	_, _ = logger.WriteStringF("cleaning up stale runs if they exist...")
+	err = utils.DeleteStaleRuns(names, staleRunTTL, names.RunID, dynClient, logger)
+	if err != nil {
+		panic(err)
 	}
 
 	t := table.NewWriter()
 	t.AppendHeader(table.Row{"Test Name", "Result", "Test Message"})
 
-	RunTestsAndAppendToTable(t, clusterFQDN)
+	p := progress.NewProgress(logger)
+
+	_, _ = logger.WriteStringF("running cluster checks...")
+	RunTestsAndAppendToTable(t, p, clusterFQDN, templateOpts.Endpoints, templateOpts.ClockSkew,
+		templateOpts.OpenShift)
 
 	_, _ = logger.WriteStringF("deploying runai diagnostics tool...")
 	err = utils.CreateResources(creationOrder, dynClient)
@@ -73,13 +153,20 @@ func Main(clean, dryRun bool, backendFQDN, clusterFQDN, image, imagePullSecretNa
 		panic(err)
 	}
 
+	if templateOpts.OpenShift {
+		t.AppendSeparator()
+		sccAdmission(t, p, names)
+	}
+
 	// wait for job tests to complete and collect results
-	err = utils.WaitForJobsToComplete(10*time.Second, 5*time.Minute)
+	err = utils.WaitForJobsToComplete(names, 10*time.Second, templateOpts.AgentsTimeout(len(nodeNames), zones), p.AgentsUpdate)
+	p.Done()
 	if err != nil {
-		panic(err)
+		// the results reported so far still show the broken nodes
+		logger.ErrorF("%v, showing the results reported so far", err)
 	}
 
-	nodesResults, err := getNodesTestsResultsTables()
+	nodesResults, err := getNodesTestsResultsTables(names, resources.NetworkPod)
 	if err != nil {
 		panic(err)
 	}
@@ -89,23 +176,97 @@ func Main(clean, dryRun bool, backendFQDN, clusterFQDN, image, imagePullSecretNa
 		utils.AppendRowToTable(t, "Node "+nodeResult.Name, nodeResult.CalculatedResult, nodeResult.TestResultsTable.Render())
 	}
 
+	if templateOpts.BackendFQDN != "" {
+		t.AppendSeparator()
+		backendFQDNConsistent(t, p, templateOpts.BackendFQDN, nodesResults)
+	}
+
+	var hostNodesResults []NodeResult
+	if templateOpts.HostNetwork {
+		hostNodesResults, err = getNodesTestsResultsTables(names, resources.NetworkHost)
+		if err != nil {
+			panic(err)
+		}
+
+		for _, nodeResult := range hostNodesResults {
+			t.AppendSeparator()
+			utils.AppendRowToTable(t, "Node "+nodeResult.Name+" (host network)", nodeResult.CalculatedResult,
+				nodeResult.TestResultsTable.Render())
+		}
+	}
+
 	_, _ = logger.WriteStringF("cleaning up...")
-	err = utils.DeleteResources(deletionOrder, dynClient, logger)
+	err = utils.DeleteRun(names, dynClient, logger)
 	if err != nil {
 		panic(err)
 	}
 
 	// compile results into a table
 	logger.WriteStringF("%s", t.Render())
+	logger.WriteStringF("%s", connectivityMatrix(nodesResults).Render())
+	if templateOpts.HostNetwork {
+		logger.WriteStringF("%s", networkComparisonMatrix(nodesResults, hostNodesResults).Render())
+	}
+
+	inventory, err := external_cluster_tests.GPUInventory()
+	if err != nil {
+		logger.ErrorF("could not list the GPU inventory: %v", err)
+	} else if len(inventory) > 0 {
+		logger.WriteStringF("%s", gpuInventoryTable(inventory).Render())
+	}
 }
 
 type NodeResult struct {
 	Name             string
 	TestResultsTable table.Writer
 	CalculatedResult bool
+	// Connectivity of the node's agent to the agents of the other nodes
+	Peers []mesh.PeerResult
+	// Answer of the node's resolver for the backend FQDN
+	BackendFQDNAnswer *v2.DNSAnswer
 }
 
-func getNodesTestsResultsTables() ([]NodeResult, error) {
+// clusterNodes returns the names of the nodes of the cluster and the number
+// of zones they are spread over.
+func clusterNodes() ([]string, int, error) {
+	k8s, err := k8sclient.ClientSet()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	nodeList, err := k8s.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	nodeNames := []string{}
+	zones := map[string]struct{}{}
+	for _, node := range nodeList.Items {
+		nodeNames = append(nodeNames, node.Name)
+		if zone := node.Labels[v1.LabelTopologyZone]; zone != "" {
+			zones[zone] = struct{}{}
+		}
+	}
+
+	return nodeNames, len(zones), nil
+}
+
+// missingNodeResult stands for a node whose agent failed or did not report
+// its results in time.
+func missingNodeResult(nodeName string) NodeResult {
+	t := table.NewWriter()
+	t.AppendHeader(table.Row{"Test Name", "Result", "Test Message"})
+	utils.AppendRowToTable(t, "Agent Results", false,
+		"the agent of the node failed or did not report its results in time, see the logs of its pod")
+
+	return NodeResult{
+		Name:             nodeName,
+		TestResultsTable: t,
+		CalculatedResult: false,
+	}
+}
+
+func getNodesTestsResultsTables(names resources.Names, network resources.Network) ([]NodeResult, error) {
 	nodesResults := []NodeResult{}
 
 	k8s, err := k8sclient.ClientSet()
@@ -119,8 +280,12 @@ func getNodesTestsResultsTables() ([]NodeResult, error) {
 	}
 
 	for _, node := range nodeList.Items {
-		cm, err := k8s.CoreV1().ConfigMaps("runai-diagnostics").
-			Get(context.TODO(), "runai-diagnostics-"+node.Name, metav1.GetOptions{})
+		cm, err := k8s.CoreV1().ConfigMaps(names.Namespace).
+			Get(context.TODO(), names.ForAgent(node.Name, network), metav1.GetOptions{})
+		if kerrors.IsNotFound(err) {
+			nodesResults = append(nodesResults, missingNodeResult(node.Name))
+			continue
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -146,10 +311,29 @@ func getNodesTestsResultsTables() ([]NodeResult, error) {
 			}
 		}
 
+		var peers []mesh.PeerResult
+		if peersJSON, found := cm.Data[mesh.ConfigMapKey]; found {
+			err = json.Unmarshal([]byte(peersJSON), &peers)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		var backendFQDNAnswer *v2.DNSAnswer
+		if answerJSON, found := cm.Data[v2.DNSConfigMapKey]; found {
+			backendFQDNAnswer = &v2.DNSAnswer{}
+			err = json.Unmarshal([]byte(answerJSON), backendFQDNAnswer)
+			if err != nil {
+				return nil, err
+			}
+		}
+
 		nodesResults = append(nodesResults, NodeResult{
-			Name:             node.Name,
-			TestResultsTable: t,
-			CalculatedResult: pass,
+			Name:              node.Name,
+			TestResultsTable:  t,
+			CalculatedResult:  pass,
+			Peers:             peers,
+			BackendFQDNAnswer: backendFQDNAnswer,
 		})
 	}
 
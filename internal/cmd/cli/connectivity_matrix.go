@@ -0,0 +1,134 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/run-ai/preinstall-diagnostics/internal/log"
+	"github.com/run-ai/preinstall-diagnostics/internal/mesh"
+)
+
+// connectivityMatrix renders the connectivity from every node (rows) to every
+// node (columns). Columns are numbered after the rows to keep the matrix
+// narrow on large clusters.
+func connectivityMatrix(nodesResults []NodeResult) table.Writer {
+	t := table.NewWriter()
+	t.SetTitle("Node Connectivity (median RTT, clock offset when skewed, path MTU when lower than the interface MTU)")
+
+	header := table.Row{"#", "From \\ To"}
+	for i := range nodesResults {
+		header = append(header, strconv.Itoa(i+1))
+	}
+	t.AppendHeader(header)
+
+	for i, source := range nodesResults {
+		peers := peersByNode(source.Peers)
+
+		row := table.Row{i + 1, source.Name}
+		for _, target := range nodesResults {
+			peer, found := peers[target.Name]
+			row = append(row, matrixCell(peer, found))
+		}
+		t.AppendRow(row)
+	}
+
+	return t
+}
+
+func matrixCell(peer mesh.PeerResult, found bool) string {
+	if !found {
+		return "-"
+	}
+
+	if !peer.Reachable {
+		return log.Red("FAIL")
+	}
+
+	cell := formatRTT(peer.RTTP50)
+	if peer.ClockSkewFailed || peer.ClockSkewWarning {
+		cell += fmt.Sprintf(" %+.3fs", peer.ClockOffset.Seconds())
+	}
+	if peer.MTUMismatch() {
+		if peer.PathMTU > 0 {
+			cell += fmt.Sprintf(" mtu %d", peer.PathMTU)
+		} else {
+			cell += " mtu ?"
+		}
+	}
+
+	switch {
+	case peer.ClockSkewFailed || peer.LargeTransferError != "":
+		return log.Red(cell)
+	case peer.ClockSkewWarning || peer.MTUMismatch():
+		return log.Yellow(cell)
+	default:
+		return cell
+	}
+}
+
+func formatRTT(rtt time.Duration) string {
+	return fmt.Sprintf("%.1fms", rtt.Seconds()*1000)
+}
+
+// networkComparisonMatrix contrasts the connectivity of every pair of nodes
+// over the pod network and over the host network. Pairs failing on the pod
+// network only point at the CNI, pairs failing on both at the hosts or at a
+// firewall.
+func networkComparisonMatrix(podResults, hostResults []NodeResult) table.Writer {
+	t := table.NewWriter()
+	t.SetTitle("Pod vs Host Network (CNI: pod network only fails, HOST: host network only fails, BOTH: both fail)")
+
+	header := table.Row{"#", "From \\ To"}
+	for i := range podResults {
+		header = append(header, strconv.Itoa(i+1))
+	}
+	t.AppendHeader(header)
+
+	hostPeersByNode := map[string][]mesh.PeerResult{}
+	for _, hostResult := range hostResults {
+		hostPeersByNode[hostResult.Name] = hostResult.Peers
+	}
+
+	for i, source := range podResults {
+		podPeers := peersByNode(source.Peers)
+		hostPeers := peersByNode(hostPeersByNode[source.Name])
+
+		row := table.Row{i + 1, source.Name}
+		for _, target := range podResults {
+			podPeer, podFound := podPeers[target.Name]
+			hostPeer, hostFound := hostPeers[target.Name]
+			row = append(row, comparisonCell(podPeer, podFound, hostPeer, hostFound))
+		}
+		t.AppendRow(row)
+	}
+
+	return t
+}
+
+func comparisonCell(podPeer mesh.PeerResult, podFound bool, hostPeer mesh.PeerResult, hostFound bool) string {
+	if !podFound || !hostFound {
+		return "-"
+	}
+
+	switch {
+	case podPeer.Reachable && hostPeer.Reachable:
+		return "ok"
+	case hostPeer.Reachable:
+		return log.Red("CNI")
+	case podPeer.Reachable:
+		return log.Yellow("HOST")
+	default:
+		return log.Red("BOTH")
+	}
+}
+
+func peersByNode(peers []mesh.PeerResult) map[string]mesh.PeerResult {
+	byNode := map[string]mesh.PeerResult{}
+	for _, peer := range peers {
+		byNode[peer.Node] = peer
+	}
+
+	return byNode
+}
@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/run-ai/preinstall-diagnostics/internal/log"
+	"github.com/run-ai/preinstall-diagnostics/internal/mesh"
+)
+
+func meshResults(nodes []string, reachable bool) []NodeResult {
+	results := []NodeResult{}
+	for _, source := range nodes {
+		result := NodeResult{Name: source}
+		for _, target := range nodes {
+			peer := mesh.PeerResult{Node: target, Reachable: reachable || source == target}
+			if !peer.Reachable {
+				peer.Error = "context deadline exceeded"
+			}
+			result.Peers = append(result.Peers, peer)
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+func TestNetworkComparisonMatrixPodNetworkDown(t *testing.T) {
+	nodes := []string{"node-1", "node-2", "node-3"}
+	podResults := meshResults(nodes, false)
+	hostResults := meshResults(nodes, true)
+	// the agent of node-3 did not report in time
+	podResults[2] = missingNodeResult("node-3")
+
+	rendered := networkComparisonMatrix(podResults, hostResults).Render()
+
+	rows := map[string]string{}
+	for _, line := range strings.Split(rendered, "\n") {
+		for _, node := range nodes {
+			if strings.Contains(line, " "+node+" ") {
+				rows[node] = line
+			}
+		}
+	}
+
+	for _, test := range []struct {
+		node string
+		want []string
+	}{
+		{"node-1", []string{"ok", log.Red("CNI"), log.Red("CNI")}},
+		{"node-2", []string{log.Red("CNI"), "ok", log.Red("CNI")}},
+		{"node-3", []string{"-", "-", "-"}},
+	} {
+		row, found := rows[test.node]
+		if !found {
+			t.Fatalf("no row for %s in:\n%s", test.node, rendered)
+		}
+
+		cells := strings.Split(row, "|")
+		// leading border, number and name
+		got := []string{}
+		for _, cell := range cells[3 : len(cells)-1] {
+			got = append(got, strings.TrimSpace(cell))
+		}
+		if strings.Join(got, ",") != strings.Join(test.want, ",") {
+			t.Errorf("%s: got %q, want %q", test.node, got, test.want)
+		}
+	}
+}
+
+func TestConnectivityMatrixPodNetworkDown(t *testing.T) {
+	nodes := []string{"node-1", "node-2"}
+
+	rendered := connectivityMatrix(meshResults(nodes, false)).Render()
+
+	if count := strings.Count(rendered, log.Red("FAIL")); count != 2 {
+		t.Errorf("got %d failed pairs, want 2 in:\n%s", count, rendered)
+	}
+}
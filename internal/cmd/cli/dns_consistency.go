@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	v2 "github.com/run-ai/preinstall-diagnostics/internal"
+	"github.com/run-ai/preinstall-diagnostics/internal/progress"
+)
+
+// backendFQDNConsistent compares the addresses the backend FQDN resolves to
+// on every node and on the machine running the CLI. Differences point at
+// split-horizon DNS or stale node-local caches.
+func backendFQDNConsistent(t table.Writer, p *progress.Progress, backendFQDN string, nodesResults []NodeResult) {
+	testName := "Backend FQDN DNS Consistency"
+
+	answers := map[string]*v2.DNSAnswer{}
+	cliAnswer := &v2.DNSAnswer{
+		Name: backendFQDN,
+	}
+	ips, err := net.DefaultResolver.LookupIP(context.TODO(), "ip", backendFQDN)
+	if err != nil {
+		cliAnswer.Error = err.Error()
+	}
+	for _, ip := range ips {
+		cliAnswer.IPs = append(cliAnswer.IPs, ip.String())
+	}
+	answers["this machine"] = cliAnswer
+
+	for _, nodeResult := range nodesResults {
+		if nodeResult.BackendFQDNAnswer != nil {
+			answers["node "+nodeResult.Name] = nodeResult.BackendFQDNAnswer
+		}
+	}
+
+	// resolvers grouped by the set of addresses they answered with
+	groups := map[string][]string{}
+	failures := []string{}
+	for resolver, answer := range answers {
+		if answer.Error != "" {
+			failures = append(failures, fmt.Sprintf("%s: %s", resolver, answer.Error))
+			continue
+		}
+
+		answerIPs := append([]string{}, answer.IPs...)
+		sort.Strings(answerIPs)
+		key := strings.Join(answerIPs, ", ")
+		groups[key] = append(groups[key], resolver)
+	}
+
+	lines := []string{}
+	for ips, resolvers := range groups {
+		sort.Strings(resolvers)
+		lines = append(lines, fmt.Sprintf("%s: %s", ips, strings.Join(resolvers, ", ")))
+	}
+	sort.Strings(lines)
+	sort.Strings(failures)
+	lines = append(lines, failures...)
+
+	message := strings.Join(lines, "\n")
+	if len(groups) > 1 {
+		message = "nodes resolve " + backendFQDN + " to different addresses\n" + message
+	}
+
+	appendCheckResult(t, p, testName, len(groups) <= 1 && len(failures) == 0, message)
+}
@@ -2,78 +2,131 @@ package cli
 
 import (
 	"fmt"
+	"sort"
+	"strings"
+	"time"
+
 	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/run-ai/preinstall-diagnostics/internal/egress"
 	"github.com/run-ai/preinstall-diagnostics/internal/external-cluster-tests"
+	"github.com/run-ai/preinstall-diagnostics/internal/mesh"
+	"github.com/run-ai/preinstall-diagnostics/internal/probe"
+	"github.com/run-ai/preinstall-diagnostics/internal/progress"
+	"github.com/run-ai/preinstall-diagnostics/internal/resources"
 	"github.com/run-ai/preinstall-diagnostics/internal/utils"
 )
 
 const (
 	defaultStorageClassAnnotation = "storageclass.kubernetes.io/is-default-class"
+
+	sccAdmissionTimeout = time.Minute
 )
 
-func RunTestsAndAppendToTable(t table.Writer, clusterFQDN string) {
-	showClusterVersion(t)
+func RunTestsAndAppendToTable(t table.Writer, p *progress.Progress, clusterFQDN string,
+	endpoints []egress.Endpoint, clockSkew mesh.ClockSkewThresholds, openShift bool) {
+	showClusterVersion(t, p)
+	t.AppendSeparator()
+	apiServerClockInSync(t, p, clockSkew)
+	t.AppendSeparator()
+	certificatesAreValid(t, p, clusterFQDN)
+	t.AppendSeparator()
+	for _, endpoint := range egress.ForCLI(endpoints) {
+		endpointReachable(t, p, endpoint)
+		t.AppendSeparator()
+	}
+	ingressControllerExists(t, p)
+	t.AppendSeparator()
+	prometheusInstalled(t, p)
+	t.AppendSeparator()
+	showGPUNodes(t, p)
 	t.AppendSeparator()
-	certificatesAreValid(t, clusterFQDN)
+	devicePluginHealthy(t, p)
 	t.AppendSeparator()
-	helmRepoReachable(t)
+	dcgmExporterHealthy(t, p)
 	t.AppendSeparator()
-	ingressControllerExists(t)
+	gpuNodesAllocatable(t, p)
 	t.AppendSeparator()
-	prometheusInstalled(t)
+	gpuOperatorReady(t, p, openShift)
 	t.AppendSeparator()
-	showGPUNodes(t)
+	migConsistent(t, p)
 	t.AppendSeparator()
-	showStorageClasses(t)
+	showStorageClasses(t, p)
 	t.AppendSeparator()
-	listPods(t)
+	noProxyCoversCluster(t, p)
+	t.AppendSeparator()
+	listPods(t, p)
 }
 
-func showClusterVersion(t table.Writer) {
+func showClusterVersion(t table.Writer, p *progress.Progress) {
 	testName := "Kubernetes Cluster Version"
 	clusterVersion, err := external_cluster_tests.ShowClusterVersion()
 	if err != nil {
-		utils.AppendRowToTable(t, testName, false, err.Error())
+		appendCheckResult(t, p, testName, false, err.Error())
 	} else {
-		utils.AppendRowToTable(t, testName, true, clusterVersion)
+		appendCheckResult(t, p, testName, true, clusterVersion)
 	}
 }
 
-func certificatesAreValid(t table.Writer, clusterFQDN string) {
+func apiServerClockInSync(t table.Writer, p *progress.Progress, clockSkew mesh.ClockSkewThresholds) {
+	testName := "API Server Clock Offset"
+	offset, err := external_cluster_tests.APIServerClockOffset()
+	if err != nil {
+		appendCheckResult(t, p, testName, false, err.Error())
+		return
+	}
+
+	message := fmt.Sprintf("API server clock offset from this machine: %s (+/- %s)",
+		offset.Round(time.Millisecond), external_cluster_tests.APIServerClockResolution)
+	// only the part of the offset beyond the resolution of the Date header is
+	// known to be skew
+	if offset < 0 {
+		offset = -offset
+	}
+	warn, fail := clockSkew.Check(max(offset-external_cluster_tests.APIServerClockResolution, 0))
+	if fail {
+		appendCheckResult(t, p, testName, false, message)
+	} else if warn {
+		appendCheckResult(t, p, testName, true, "warning: "+message)
+	} else {
+		appendCheckResult(t, p, testName, true, message)
+	}
+}
+
+func certificatesAreValid(t table.Writer, p *progress.Progress, clusterFQDN string) {
 	testName := "TLS Certificates verification"
 	err := external_cluster_tests.CertificateIsValid(clusterFQDN)
 	if err != nil {
-		utils.AppendRowToTable(t, testName, false, err.Error())
+		appendCheckResult(t, p, testName, false, err.Error())
 	} else {
-		utils.AppendRowToTable(t, testName, true, "")
+		appendCheckResult(t, p, testName, true, "")
 	}
 }
 
-func helmRepoReachable(t table.Writer) {
-	testName := "Helm Repository Connectivity"
-	reachable, err := external_cluster_tests.RunAIHelmRepositoryReachable()
+func endpointReachable(t table.Writer, p *progress.Progress, endpoint egress.Endpoint) {
+	testName := endpoint.Name + " Reachable"
+	message, err := endpoint.Probe()
 	if err != nil {
-		utils.AppendRowToTable(t, testName, false, err.Error())
+		appendCheckResult(t, p, testName, false, err.Error()+"\n"+message)
 	} else {
-		utils.AppendRowToTable(t, testName, reachable, "")
+		appendCheckResult(t, p, testName, true, message)
 	}
 }
 
-func ingressControllerExists(t table.Writer) {
+func ingressControllerExists(t table.Writer, p *progress.Progress) {
 	testName := "Ingress Controller Installed"
 	exists, err := external_cluster_tests.IngressControllerInstalled()
 	if err != nil {
-		utils.AppendRowToTable(t, testName, false, err.Error())
+		appendCheckResult(t, p, testName, false, err.Error())
 	} else {
-		utils.AppendRowToTable(t, testName, exists, "")
+		appendCheckResult(t, p, testName, exists, "")
 	}
 }
 
-func listPods(t table.Writer) {
+func listPods(t table.Writer, p *progress.Progress) {
 	testName := "Pod List"
 	pods, err := external_cluster_tests.ListPods()
 	if err != nil {
-		utils.AppendRowToTable(t, testName, false, err.Error())
+		appendCheckResult(t, p, testName, false, err.Error())
 	} else {
 		podsStr := ""
 		for i := range pods {
@@ -83,25 +136,25 @@ func listPods(t table.Writer) {
 				podsStr += "\n"
 			}
 		}
-		utils.AppendRowToTable(t, testName, true, podsStr)
+		appendCheckResult(t, p, testName, true, podsStr)
 	}
 }
 
-func prometheusInstalled(t table.Writer) {
+func prometheusInstalled(t table.Writer, p *progress.Progress) {
 	testName := "Prometheus Installed"
 	installed, err := external_cluster_tests.PrometheusInstalled()
 	if err != nil {
-		utils.AppendRowToTable(t, testName, false, err.Error())
+		appendCheckResult(t, p, testName, false, err.Error())
 	} else {
-		utils.AppendRowToTable(t, testName, installed, "")
+		appendCheckResult(t, p, testName, installed, "")
 	}
 }
 
-func showGPUNodes(t table.Writer) {
+func showGPUNodes(t table.Writer, p *progress.Progress) {
 	testName := "GPU Nodes"
 	nodes, err := external_cluster_tests.ShowGPUNodes()
 	if err != nil {
-		utils.AppendRowToTable(t, testName, false, err.Error())
+		appendCheckResult(t, p, testName, false, err.Error())
 	} else {
 		nodesStr := ""
 		for i := range nodes {
@@ -111,15 +164,131 @@ func showGPUNodes(t table.Writer) {
 				nodesStr += "\n"
 			}
 		}
-		utils.AppendRowToTable(t, testName, true, nodesStr)
+		appendCheckResult(t, p, testName, true, nodesStr)
 	}
 }
 
-func showStorageClasses(t table.Writer) {
+func devicePluginHealthy(t table.Writer, p *progress.Progress) {
+	testName := "NVIDIA Device Plugin"
+	daemonSets, err := external_cluster_tests.DevicePluginHealth()
+	if err != nil {
+		appendCheckResult(t, p, testName, false, err.Error())
+	} else if len(daemonSets) == 0 {
+		// a device plugin is only needed on clusters with GPU nodes
+		_, gpuNodes, err := external_cluster_tests.GPUNodesWithoutDevicePlugin()
+		if err != nil {
+			appendCheckResult(t, p, testName, false, err.Error())
+		} else if gpuNodes == 0 {
+			appendCheckResult(t, p, testName, true, "skipped: no GPU nodes")
+		} else {
+			appendCheckResult(t, p, testName, false,
+				fmt.Sprintf("no NVIDIA device plugin DaemonSet found in the cluster, %d GPU nodes cannot run GPU workloads",
+					gpuNodes))
+		}
+	} else {
+		appendDaemonSetsResult(t, p, testName, daemonSets)
+	}
+}
+
+func dcgmExporterHealthy(t table.Writer, p *progress.Progress) {
+	testName := "DCGM Exporter"
+	daemonSets, err := external_cluster_tests.DCGMExporterHealth()
+	if err != nil {
+		appendCheckResult(t, p, testName, false, err.Error())
+	} else if len(daemonSets) == 0 {
+		appendCheckResult(t, p, testName, true,
+			"warning: no DCGM exporter DaemonSet found in the cluster, GPU metrics will be missing")
+	} else {
+		appendDaemonSetsResult(t, p, testName, daemonSets)
+	}
+}
+
+func appendDaemonSetsResult(t table.Writer, p *progress.Progress, testName string,
+	daemonSets []external_cluster_tests.WorkloadHealth) {
+	healthy := true
+	daemonSetsStr := ""
+	for i := range daemonSets {
+		healthy = healthy && daemonSets[i].Healthy()
+		daemonSetsStr += daemonSets[i].String()
+		if i < len(daemonSets)-1 {
+			daemonSetsStr += "\n"
+		}
+	}
+	appendCheckResult(t, p, testName, healthy, daemonSetsStr)
+}
+
+func gpuNodesAllocatable(t table.Writer, p *progress.Progress) {
+	testName := "GPU Nodes Allocatable"
+	issues, gpuNodes, err := external_cluster_tests.GPUNodesWithoutDevicePlugin()
+	if err != nil {
+		appendCheckResult(t, p, testName, false, err.Error())
+	} else if gpuNodes == 0 {
+		appendCheckResult(t, p, testName, true, "skipped: no GPU nodes")
+	} else if len(issues) > 0 {
+		nodeNames := []string{}
+		for nodeName := range issues {
+			nodeNames = append(nodeNames, nodeName)
+		}
+		sort.Strings(nodeNames)
+
+		issuesStr := fmt.Sprintf("%d of %d GPU nodes cannot run GPU workloads:", len(issues), gpuNodes)
+		for _, nodeName := range nodeNames {
+			issuesStr += fmt.Sprintf("\n%s: %s", nodeName, strings.Join(issues[nodeName], ", "))
+		}
+		appendCheckResult(t, p, testName, false, issuesStr)
+	} else {
+		appendCheckResult(t, p, testName, true,
+			fmt.Sprintf("all %d GPU nodes run a ready device plugin and allocate NVIDIA GPUs", gpuNodes))
+	}
+}
+
+func gpuOperatorReady(t table.Writer, p *progress.Progress, openShift bool) {
+	testName := "NVIDIA GPU Operator"
+	status, err := external_cluster_tests.GPUOperator(openShift)
+	if err != nil {
+		appendCheckResult(t, p, testName, false, err.Error())
+	} else if status == nil {
+		appendCheckResult(t, p, testName, true,
+			"warning: the NVIDIA GPU Operator is not installed, the GPU driver, toolkit and device plugin must be installed otherwise")
+	} else {
+		appendCheckResult(t, p, testName, status.Healthy(), status.String())
+	}
+}
+
+func migConsistent(t table.Writer, p *progress.Progress) {
+	testName := "MIG Consistency"
+	report, err := external_cluster_tests.MIGConsistency()
+	if err != nil {
+		appendCheckResult(t, p, testName, false, err.Error())
+		return
+	}
+
+	if len(report.Nodes) == 0 {
+		appendCheckResult(t, p, testName, true, "skipped: no MIG capable or configured nodes")
+		return
+	}
+
+	lines := []string{}
+	for _, node := range report.Nodes {
+		lines = append(lines, node.String())
+	}
+	lines = append(lines, report.Failures...)
+	for _, warning := range report.Warnings {
+		lines = append(lines, "warning: "+warning)
+	}
+
+	message := strings.Join(lines, "\n")
+	if len(report.Failures) == 0 && len(report.Warnings) > 0 {
+		message = "warning: " + message
+	}
+	appendCheckResult(t, p, testName, len(report.Failures) == 0, message)
+}
+
+func showStorageClasses(t table.Writer, p *progress.Progress) {
 	testName := "Available StorageClasses"
 	scs, err := external_cluster_tests.ShowStorageClasses()
 	if err != nil {
-		utils.AppendRowToTable(t, testName, false, err.Error())
+		appendCheckResult(t, p, testName, false, err.Error())
 	} else {
 		scsStr := ""
 		for i := range scs {
@@ -135,6 +304,54 @@ func showStorageClasses(t table.Writer) {
 				scsStr += "\n"
 			}
 		}
-		utils.AppendRowToTable(t, testName, true, scsStr)
+		appendCheckResult(t, p, testName, true, scsStr)
+	}
+}
+
+func noProxyCoversCluster(t table.Writer, p *progress.Progress) {
+	testName := "NO_PROXY Covers Cluster"
+	uncovered, err := external_cluster_tests.NoProxyUncovered()
+	if err != nil {
+		appendCheckResult(t, p, testName, false, err.Error())
+	} else if !probe.ProxyConfigured() {
+		appendCheckResult(t, p, testName, true, "no proxy configured")
+	} else if len(uncovered) > 0 {
+		uncoveredStr := "in-cluster destinations would be sent through the proxy, add them to NO_PROXY:"
+		for i := range uncovered {
+			uncoveredStr += "\n" + uncovered[i]
+		}
+		appendCheckResult(t, p, testName, false, uncoveredStr)
+	} else {
+		appendCheckResult(t, p, testName, true, "")
+	}
+}
+
+func sccAdmission(t table.Writer, p *progress.Progress, names resources.Names) {
+	testName := "OpenShift SCC Admission"
+	failures, err := external_cluster_tests.SCCAdmission(names, sccAdmissionTimeout)
+	if err != nil {
+		appendCheckResult(t, p, testName, false, err.Error())
+	} else if len(failures) > 0 {
+		jobNames := []string{}
+		for jobName := range failures {
+			jobNames = append(jobNames, jobName)
+		}
+		sort.Strings(jobNames)
+
+		failuresStr := ""
+		for i, jobName := range jobNames {
+			failuresStr += fmt.Sprintf("%s: %s", jobName, failures[jobName])
+			if i < len(jobNames)-1 {
+				failuresStr += "\n"
+			}
+		}
+		appendCheckResult(t, p, testName, false, failuresStr)
+	} else {
+		appendCheckResult(t, p, testName, true, "all agents were admitted with SCC "+names.ForRun())
 	}
 }
+
+func appendCheckResult(t table.Writer, p *progress.Progress, testName string, testResult bool, testMessage string) {
+	utils.AppendRowToTable(t, testName, testResult, testMessage)
+	p.CheckDone(testName, testResult)
+}
@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/run-ai/preinstall-diagnostics/internal/external-cluster-tests"
+)
+
+// gpuInventoryTable renders the GPUs of every GPU node, followed by the
+// totals of every GPU model.
+func gpuInventoryTable(inventory []external_cluster_tests.GPUNodeInventory) table.Writer {
+	t := table.NewWriter()
+	t.SetTitle("GPU Inventory")
+	t.AppendHeader(table.Row{"Node", "Product", "GPUs", "Memory", "Compute", "Driver", "CUDA", "MIG Strategy",
+		"Allocatable", "Allocated"})
+
+	type modelTotals struct {
+		nodes       int
+		gpus        int
+		allocatable int64
+		allocated   int64
+	}
+	totals := map[string]*modelTotals{}
+
+	for _, node := range inventory {
+		t.AppendRow(table.Row{node.Node, node.Product, node.Count, orDash(node.Memory), orDash(node.Compute),
+			orDash(node.Driver), orDash(node.CUDA), orDash(node.MIGStrategy), node.Allocatable, node.Allocated})
+
+		if totals[node.Product] == nil {
+			totals[node.Product] = &modelTotals{}
+		}
+		total := totals[node.Product]
+		total.nodes++
+		count, _ := strconv.Atoi(node.Count)
+		total.gpus += count
+		total.allocatable += node.Allocatable
+		total.allocated += node.Allocated
+	}
+
+	products := []string{}
+	for product := range totals {
+		products = append(products, product)
+	}
+	sort.Strings(products)
+
+	t.AppendSeparator()
+	for _, product := range products {
+		total := totals[product]
+		t.AppendRow(table.Row{strconv.Itoa(total.nodes) + " nodes", product, total.gpus, "", "", "", "", "",
+			total.allocatable, total.allocated})
+	}
+
+	return t
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+
+	return value
+}
@@ -2,130 +2,249 @@ package job
 
 import (
 	v2 "github.com/run-ai/preinstall-diagnostics/internal"
+	"github.com/run-ai/preinstall-diagnostics/internal/egress"
 	"github.com/run-ai/preinstall-diagnostics/internal/env"
 	internal_cluster_tests2 "github.com/run-ai/preinstall-diagnostics/internal/internal-cluster-tests"
 	"github.com/run-ai/preinstall-diagnostics/internal/log"
+	"github.com/run-ai/preinstall-diagnostics/internal/mesh"
+	"github.com/run-ai/preinstall-diagnostics/internal/resources"
 	"strconv"
+	"strings"
 )
 
-func runTestsAndAppendResults(logger *log.Logger) []v2.TestResult {
+func runTestsAndAppendResults(logger *log.Logger) ([]v2.TestResult, []mesh.PeerResult, *v2.DNSAnswer) {
 	var testResults []v2.TestResult
-	osInfo, err := internal_cluster_tests2.ShowOSInfo()
-	if err != nil {
-		testResults = append(testResults, v2.TestResult{
-			Name:    "OS Info",
-			Result:  false,
-			Message: err.Error(),
-		})
-	} else {
-		testResults = append(testResults, v2.TestResult{
-			Name:    "OS Info",
-			Result:  true,
-			Message: osInfo,
-		})
-	}
+	var backendFQDNAnswer *v2.DNSAnswer
+	// the host network agent only repeats the network checks, for them to be
+	// compared with the pod network agent's
+	hostNetwork := resources.NetworkFromEnv() == resources.NetworkHost
 
-	ips, err := internal_cluster_tests2.BackendFQDNResolvable()
-	if err != nil {
-		testResults = append(testResults, v2.TestResult{
-			Name:    "Backend FQDN Resolve",
-			Result:  false,
-			Message: err.Error(),
-		})
-	} else {
-		ipsStr := ""
-		for i := range ips {
-			ipsStr += ips[i].String()
-			if i < len(ips)-1 {
-				ipsStr += "\n"
-			}
+	throughput := internal_cluster_tests2.ThroughputEnabled()
+	if throughput {
+		err := internal_cluster_tests2.StartThroughputServer()
+		if err != nil {
+			testResults = append(testResults, v2.TestResult{
+				Name:    "Throughput Server",
+				Result:  false,
+				Message: err.Error(),
+			})
+			throughput = false
 		}
-		testResults = append(testResults, v2.TestResult{
-			Name:    "Backend FQDN Resolve",
-			Result:  true,
-			Message: ipsStr,
-		})
-	}
-
-	dnsResolveConf, err := internal_cluster_tests2.DNSResolvConf()
-	if err != nil {
-		testResults = append(testResults, v2.TestResult{
-			Name:    "DNS Resolve Conf",
-			Result:  false,
-			Message: err.Error(),
-		})
-	} else {
-		testResults = append(testResults, v2.TestResult{
-			Name:    "DNS Resolve Conf",
-			Result:  true,
-			Message: dnsResolveConf,
-		})
 	}
 
 	airgapped, err := strconv.ParseBool(env.EnvOrDefault(env.AirgappedEnvVar, "false"))
 	if err != nil {
 		airgapped = false
 	}
-	if !airgapped {
-		reachable, err := internal_cluster_tests2.RunAIAuthProviderReachable()
+
+	if !hostNetwork {
+		osInfo, err := internal_cluster_tests2.ShowOSInfo()
+		if err != nil {
+			testResults = append(testResults, v2.TestResult{
+				Name:    "OS Info",
+				Result:  false,
+				Message: err.Error(),
+			})
+		} else {
+			testResults = append(testResults, v2.TestResult{
+				Name:    "OS Info",
+				Result:  true,
+				Message: osInfo,
+			})
+		}
+
+		ips, err := internal_cluster_tests2.BackendFQDNResolvable()
+		if backendFQDN := env.EnvOrDefault(env.BackendFQDNEnvVar, ""); backendFQDN != "" {
+			backendFQDNAnswer = &v2.DNSAnswer{
+				Name: backendFQDN,
+			}
+			for _, ip := range ips {
+				backendFQDNAnswer.IPs = append(backendFQDNAnswer.IPs, ip.String())
+			}
+			if err != nil {
+				backendFQDNAnswer.Error = err.Error()
+			}
+		}
 		if err != nil {
 			testResults = append(testResults, v2.TestResult{
-				Name:    "RunAI Auth Provider Reachable",
+				Name:    "Backend FQDN Resolve",
 				Result:  false,
 				Message: err.Error(),
 			})
 		} else {
+			ipsStr := ""
+			for i := range ips {
+				ipsStr += ips[i].String()
+				if i < len(ips)-1 {
+					ipsStr += "\n"
+				}
+			}
 			testResults = append(testResults, v2.TestResult{
-				Name:    "RunAI Auth Provider Reachable",
-				Result:  reachable,
-				Message: "",
+				Name:    "Backend FQDN Resolve",
+				Result:  true,
+				Message: ipsStr,
 			})
 		}
 
-		reachable, err = internal_cluster_tests2.RunAIPrometheusReachable()
+		dnsResolveConf, err := internal_cluster_tests2.DNSResolvConf()
 		if err != nil {
 			testResults = append(testResults, v2.TestResult{
-				Name:    "RunAI Prometheus Reachable",
+				Name:    "DNS Resolve Conf",
 				Result:  false,
 				Message: err.Error(),
 			})
 		} else {
 			testResults = append(testResults, v2.TestResult{
-				Name:    "RunAI Prometheus Reachable",
-				Result:  reachable,
-				Message: "",
+				Name:    "DNS Resolve Conf",
+				Result:  true,
+				Message: dnsResolveConf,
 			})
 		}
 
-		reachable, err = internal_cluster_tests2.RunAIBackendReachable()
+		lookupQuality, err := internal_cluster_tests2.BackendFQDNLookupQuality()
 		if err != nil {
 			testResults = append(testResults, v2.TestResult{
-				Name:    "RunAI Backend Reachable",
+				Name:    "Backend FQDN Lookups",
 				Result:  false,
 				Message: err.Error(),
 			})
 		} else {
 			testResults = append(testResults, v2.TestResult{
-				Name:    "RunAI Backend Reachable",
-				Result:  reachable,
-				Message: "",
+				Name:    "Backend FQDN Lookups",
+				Result:  true,
+				Message: lookupQuality,
 			})
 		}
+
+		if !airgapped {
+			publicResolvers, err := internal_cluster_tests2.DNSRecordsResolvable()
+			if err != nil {
+				testResults = append(testResults, v2.TestResult{
+					Name:    "Public DNS Resolvers",
+					Result:  false,
+					Message: err.Error(),
+				})
+			} else {
+				testResults = append(testResults, v2.TestResult{
+					Name:    "Public DNS Resolvers",
+					Result:  true,
+					Message: publicResolvers,
+				})
+			}
+		}
 	}
-	err = internal_cluster_tests2.CheckNodeConnectivity(logger)
+
+	endpoints, err := egress.EndpointsFromEnv()
 	if err != nil {
 		testResults = append(testResults, v2.TestResult{
-			Name:    "Node Connectivity",
+			Name:    "Egress Endpoints",
 			Result:  false,
 			Message: err.Error(),
 		})
+	}
+
+	for _, endpoint := range endpoints {
+		message, err := endpoint.Probe()
+		if err != nil {
+			testResults = append(testResults, v2.TestResult{
+				Name:    endpoint.Name + " Reachable",
+				Result:  false,
+				Message: err.Error() + "\n" + message,
+			})
+		} else {
+			testResults = append(testResults, v2.TestResult{
+				Name:    endpoint.Name + " Reachable",
+				Result:  true,
+				Message: message,
+			})
+		}
+	}
+
+	peers, err := internal_cluster_tests2.CheckNodeConnectivity(logger)
+	if err != nil {
+		testResults = append(testResults, v2.TestResult{
+			Name:    "Node Connectivity",
+			Result:  false,
+			Message: err.Error() + "\n" + mesh.Describe(peers),
+		})
 	} else {
 		testResults = append(testResults, v2.TestResult{
 			Name:    "Node Connectivity",
 			Result:  true,
-			Message: "",
+			Message: mesh.Describe(peers),
 		})
 	}
 
-	return testResults
+	if throughput {
+		measurements, err := internal_cluster_tests2.MeasureThroughput(logger)
+		if err != nil {
+			testResults = append(testResults, v2.TestResult{
+				Name:    "Throughput",
+				Result:  false,
+				Message: err.Error(),
+			})
+		}
+
+		for _, measurement := range measurements {
+			if measurement.Err != nil {
+				testResults = append(testResults, v2.TestResult{
+					Name:    "Throughput to " + measurement.Node,
+					Result:  false,
+					Message: measurement.Err.Error(),
+				})
+			} else {
+				testResults = append(testResults, v2.TestResult{
+					Name:    "Throughput to " + measurement.Node,
+					Result:  true,
+					Message: measurement.Result.String(),
+				})
+			}
+		}
+	}
+
+	if !hostNetwork {
+		for _, check := range []struct {
+			name  string
+			check func() (string, error)
+		}{
+			{"Kubernetes Service Resolve", internal_cluster_tests2.KubernetesServiceResolvable},
+			{"Headless Service Resolve", internal_cluster_tests2.HeadlessServiceResolvable},
+			{"ClusterIP Service Reachable", internal_cluster_tests2.ServiceReachable},
+			{"API Server Service IP Reachable", internal_cluster_tests2.APIServerServiceReachable},
+		} {
+			message, err := check.check()
+			if err != nil {
+				testResults = append(testResults, v2.TestResult{
+					Name:    check.name,
+					Result:  false,
+					Message: err.Error(),
+				})
+			} else {
+				testResults = append(testResults, v2.TestResult{
+					Name:    check.name,
+					Result:  true,
+					Message: message,
+				})
+			}
+		}
+	}
+
+	if internal_cluster_tests2.HostInspectionEnabled() {
+		for _, check := range internal_cluster_tests2.InspectHost() {
+			message := check.Message
+			if check.Skipped {
+				message = "skipped: " + message
+			} else if check.Warning && !strings.HasPrefix(message, "warning: ") {
+				message = "warning: " + message
+			}
+
+			testResults = append(testResults, v2.TestResult{
+				Name:    "Host " + check.Name,
+				Result:  !check.Failed,
+				Message: message,
+			})
+		}
+	}
+
+	return testResults, peers, backendFQDNAnswer
 }
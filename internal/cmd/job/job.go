@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	v2 "github.com/run-ai/preinstall-diagnostics/internal"
 	"github.com/run-ai/preinstall-diagnostics/internal/env"
+	internal_cluster_tests2 "github.com/run-ai/preinstall-diagnostics/internal/internal-cluster-tests"
 	"github.com/run-ai/preinstall-diagnostics/internal/k8sclient"
 	"github.com/run-ai/preinstall-diagnostics/internal/log"
+	"github.com/run-ai/preinstall-diagnostics/internal/mesh"
 	"github.com/run-ai/preinstall-diagnostics/internal/resources"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -14,17 +16,21 @@ import (
 )
 
 func Main(logger *log.Logger) {
-	testResults := runTestsAndAppendResults(logger)
+	testResults, peers, backendFQDNAnswer := runTestsAndAppendResults(logger)
 
 	err := deleteConfigMapIfExists()
 	if err != nil {
 		panic(err)
 	}
 
-	err = createConfigMapWithTestResults(testResults)
+	err = createConfigMapWithTestResults(testResults, peers, backendFQDNAnswer)
 	if err != nil {
 		panic(err)
 	}
+
+	if internal_cluster_tests2.ThroughputEnabled() {
+		internal_cluster_tests2.WaitForThroughputSources(logger)
+	}
 }
 
 func deleteConfigMapIfExists() error {
@@ -33,8 +39,10 @@ func deleteConfigMapIfExists() error {
 		return err
 	}
 
-	err = k8s.CoreV1().ConfigMaps(resources.Namespace.Name).Delete(context.TODO(),
-		"runai-diagnostics-"+env.EnvOrDefault("NODE_NAME", ""),
+	names := resources.NamesFromEnv()
+
+	err = k8s.CoreV1().ConfigMaps(names.Namespace).Delete(context.TODO(),
+		names.ForAgent(env.EnvOrDefault(env.NodeNameEnvVar, ""), resources.NetworkFromEnv()),
 		metav1.DeleteOptions{})
 	if err != nil && !errors.IsNotFound(err) {
 		return err
@@ -43,7 +51,8 @@ func deleteConfigMapIfExists() error {
 	return nil
 }
 
-func createConfigMapWithTestResults(results []v2.TestResult) error {
+func createConfigMapWithTestResults(results []v2.TestResult, peers []mesh.PeerResult,
+	backendFQDNAnswer *v2.DNSAnswer) error {
 	k8s, err := k8sclient.ClientSet()
 	if err != nil {
 		return err
@@ -54,17 +63,34 @@ func createConfigMapWithTestResults(results []v2.TestResult) error {
 		return err
 	}
 
+	peersJSON, err := json.Marshal(peers)
+	if err != nil {
+		return err
+	}
+
+	names := resources.NamesFromEnv()
+
 	cm := v1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "runai-diagnostics-" + env.EnvOrDefault("NODE_NAME", ""),
-			Namespace: resources.Namespace.Name,
+			Name:      names.ForAgent(env.EnvOrDefault(env.NodeNameEnvVar, ""), resources.NetworkFromEnv()),
+			Namespace: names.Namespace,
+			Labels:    names.Labels(),
 		},
 		Data: map[string]string{
-			"results": string(resultsJSON),
+			"results":         string(resultsJSON),
+			mesh.ConfigMapKey: string(peersJSON),
 		},
 	}
 
-	_, err = k8s.CoreV1().ConfigMaps(resources.Namespace.Name).Create(context.TODO(), &cm, metav1.CreateOptions{})
+	if backendFQDNAnswer != nil {
+		answerJSON, err := json.Marshal(backendFQDNAnswer)
+		if err != nil {
+			return err
+		}
+		cm.Data[v2.DNSConfigMapKey] = string(answerJSON)
+	}
+
+	_, err = k8s.CoreV1().ConfigMaps(names.Namespace).Create(context.TODO(), &cm, metav1.CreateOptions{})
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,265 @@
+package egress
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/run-ai/preinstall-diagnostics/internal/env"
+	"github.com/run-ai/preinstall-diagnostics/internal/probe"
+	"sigs.k8s.io/yaml"
+)
+
+type Protocol string
+
+const (
+	ProtocolHTTPS Protocol = "HTTPS"
+	ProtocolTCP   Protocol = "TCP"
+	ProtocolTLS   Protocol = "TLS"
+	ProtocolUDP   Protocol = "UDP"
+)
+
+type Scope string
+
+const (
+	// Probed once, from the machine running the CLI
+	ScopeCLI Scope = "cli"
+	// Probed from every node
+	ScopeNodes Scope = "nodes"
+	// Probed from a sample of the nodes
+	ScopeSample Scope = "sample"
+)
+
+const (
+	authProviderURL = "https://runai-prod.auth0.com"
+	prometheusURL   = "https://prometheus-us-central1.grafana.net"
+	helmRepoURL     = "https://run-ai-charts.storage.googleapis.com"
+)
+
+// Endpoint is a destination whose reachability is checked.
+type Endpoint struct {
+	Name string `json:"name"`
+	// URL for HTTPS endpoints, host:port otherwise
+	Address  string   `json:"address"`
+	Protocol Protocol `json:"protocol,omitempty"`
+	// Accepted HTTP status codes and ranges, e.g. "200-399,401"
+	ExpectedStatus string `json:"expectedStatus,omitempty"`
+	// Request sent by UDP probes to ports other than DNS and NTP
+	Payload string `json:"payload,omitempty"`
+	Scope   Scope  `json:"scope,omitempty"`
+}
+
+// DefaultEndpoints returns the endpoints a Run:ai cluster connects to.
+func DefaultEndpoints(runaiSaas string) []Endpoint {
+	return []Endpoint{
+		{
+			Name:     "Helm Repository",
+			Address:  helmRepoURL,
+			Protocol: ProtocolHTTPS,
+			Scope:    ScopeCLI,
+		},
+		{
+			Name:     "RunAI Auth Provider",
+			Address:  authProviderURL,
+			Protocol: ProtocolHTTPS,
+			Scope:    ScopeNodes,
+		},
+		{
+			Name:     "RunAI Prometheus",
+			Address:  prometheusURL,
+			Protocol: ProtocolHTTPS,
+			Scope:    ScopeNodes,
+		},
+		{
+			Name:     "RunAI Backend",
+			Address:  runaiSaas,
+			Protocol: ProtocolHTTPS,
+			Scope:    ScopeNodes,
+		},
+	}
+}
+
+// LoadEndpoints reads a YAML or JSON list of endpoints.
+func LoadEndpoints(path string) ([]Endpoint, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := []Endpoint{}
+	err = yaml.Unmarshal(content, &endpoints)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range endpoints {
+		err := endpoints[i].validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return endpoints, nil
+}
+
+// PortTargets returns endpoints probing every node's connectivity to a
+// comma separated list of host:port addresses, over TCP or UDP.
+func PortTargets(protocol Protocol, addresses string) ([]Endpoint, error) {
+	endpoints := []Endpoint{}
+	for _, address := range strings.Split(addresses, ",") {
+		address = strings.TrimSpace(address)
+		if address == "" {
+			continue
+		}
+
+		endpoint := Endpoint{
+			Name:     fmt.Sprintf("%s %s", protocol, address),
+			Address:  address,
+			Protocol: protocol,
+			Scope:    ScopeNodes,
+		}
+
+		err := endpoint.validate()
+		if err != nil {
+			return nil, err
+		}
+
+		endpoints = append(endpoints, endpoint)
+	}
+
+	return endpoints, nil
+}
+
+// EndpointsFromEnv returns the endpoints the agent should probe.
+func EndpointsFromEnv() ([]Endpoint, error) {
+	endpointsJSON, err := env.EnvOrError(env.EndpointsEnvVar)
+	if err != nil {
+		// always set by the CLI
+		return nil, err
+	}
+
+	endpoints := []Endpoint{}
+	err = json.Unmarshal([]byte(endpointsJSON), &endpoints)
+	if err != nil {
+		return nil, err
+	}
+
+	return endpoints, nil
+}
+
+// ForNode returns the endpoints probed by the agent of a node.
+func ForNode(endpoints []Endpoint, inSample bool) []Endpoint {
+	nodeEndpoints := []Endpoint{}
+	for _, endpoint := range endpoints {
+		if endpoint.Scope == ScopeNodes || (endpoint.Scope == ScopeSample && inSample) {
+			nodeEndpoints = append(nodeEndpoints, endpoint)
+		}
+	}
+
+	return nodeEndpoints
+}
+
+// ForCLI returns the endpoints probed from the machine running the CLI.
+func ForCLI(endpoints []Endpoint) []Endpoint {
+	cliEndpoints := []Endpoint{}
+	for _, endpoint := range endpoints {
+		if endpoint.Scope == ScopeCLI {
+			cliEndpoints = append(cliEndpoints, endpoint)
+		}
+	}
+
+	return cliEndpoints
+}
+
+// SampleNodes picks size of the nodes, the same nodes are picked for the
+// same seed.
+func SampleNodes(nodeNames []string, size int, seed int64) map[string]struct{} {
+	sorted := append([]string{}, nodeNames...)
+	sort.Strings(sorted)
+
+	sample := map[string]struct{}{}
+	for i, j := range rand.New(rand.NewSource(seed)).Perm(len(sorted)) {
+		if i >= size {
+			break
+		}
+		sample[sorted[j]] = struct{}{}
+	}
+
+	return sample
+}
+
+// Probe checks the endpoint, the returned message describes the connection.
+func (e Endpoint) Probe() (string, error) {
+	opts := probe.DefaultOptions()
+	if e.ExpectedStatus != "" {
+		accepted, err := probe.ParseStatusRanges(e.ExpectedStatus)
+		if err != nil {
+			return "", err
+		}
+		opts.AcceptedStatus = accepted
+	}
+
+	switch e.Protocol {
+	case ProtocolTCP:
+		result, err := probe.TCP(e.Address, opts)
+		return result.String(), err
+	case ProtocolTLS:
+		result, err := probe.TLS(e.Address, opts)
+		return result.String(), err
+	case ProtocolUDP:
+		result, err := probe.UDP(e.Address, e.Payload, opts)
+		return result.String(), err
+	default:
+		result, err := probe.HTTP(e.Address, opts)
+		return result.String(), err
+	}
+}
+
+func (e *Endpoint) validate() error {
+	if e.Name == "" {
+		return fmt.Errorf("endpoint %q has no name", e.Address)
+	}
+
+	if e.Protocol == "" {
+		e.Protocol = ProtocolHTTPS
+	}
+
+	if e.Scope == "" {
+		e.Scope = ScopeNodes
+	}
+
+	switch e.Scope {
+	case ScopeCLI, ScopeNodes, ScopeSample:
+	default:
+		return fmt.Errorf("endpoint %s: unknown scope %q", e.Name, e.Scope)
+	}
+
+	switch e.Protocol {
+	case ProtocolHTTPS:
+		u, err := url.Parse(e.Address)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("endpoint %s: address %q is not an http(s) URL", e.Name, e.Address)
+		}
+
+		if e.ExpectedStatus != "" {
+			_, err := probe.ParseStatusRanges(e.ExpectedStatus)
+			if err != nil {
+				return fmt.Errorf("endpoint %s: %v", e.Name, err)
+			}
+		}
+	case ProtocolTCP, ProtocolTLS, ProtocolUDP:
+		_, _, err := net.SplitHostPort(e.Address)
+		if err != nil {
+			return fmt.Errorf("endpoint %s: address %q is not host:port", e.Name, e.Address)
+		}
+	default:
+		return fmt.Errorf("endpoint %s: unknown protocol %q", e.Name, e.Protocol)
+	}
+
+	return nil
+}
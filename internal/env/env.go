@@ -8,9 +8,16 @@ import (
 const (
 	KubeConfigEnvVar = "KUBECONFIG"
 
+	KubernetesServiceHostEnvVar = "KUBERNETES_SERVICE_HOST"
+	KubernetesServicePortEnvVar = "KUBERNETES_SERVICE_PORT"
+
 	NodeNameEnvVar     = "NODE_NAME"
 	PodNameEnvVar      = "POD_NAME"
 	PodNamespaceEnvVar = "POD_NAMESPACE"
+	PodIPEnvVar        = "POD_IP"
+	NamePrefixEnvVar   = "NAME_PREFIX"
+	RunIDEnvVar        = "RUN_ID"
+	AgentNetworkEnvVar = "AGENT_NETWORK"
 
 	BackendFQDNEnvVar = "BACKEND_FQDN"
 
@@ -18,6 +25,28 @@ const (
 
 	RunAISaasEnvVar = "RUNAI_SAAS"
 	AirgappedEnvVar = "AIRGAPPED"
+
+	HTTPProxyEnvVar       = "HTTP_PROXY"
+	HTTPProxyEnvVarLower  = "http_proxy"
+	HTTPSProxyEnvVar      = "HTTPS_PROXY"
+	HTTPSProxyEnvVarLower = "https_proxy"
+	NoProxyEnvVar         = "NO_PROXY"
+	NoProxyEnvVarLower    = "no_proxy"
+
+	CABundleEnvVar = "CA_BUNDLE"
+
+	EndpointsEnvVar = "ENDPOINTS"
+
+	MeshPeersEnvVar = "MESH_PEERS"
+
+	ThroughputTargetsEnvVar  = "THROUGHPUT_TARGETS"
+	ThroughputSourcesEnvVar  = "THROUGHPUT_SOURCES"
+	ThroughputDurationEnvVar = "THROUGHPUT_DURATION"
+
+	HostInspectionEnvVar = "HOST_INSPECTION"
+
+	ClockSkewWarnEnvVar = "CLOCK_SKEW_WARN"
+	ClockSkewFailEnvVar = "CLOCK_SKEW_FAIL"
 )
 
 func EnvOrError(envVar string) (string, error) {
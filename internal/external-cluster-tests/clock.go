@@ -0,0 +1,53 @@
+package external_cluster_tests
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/run-ai/preinstall-diagnostics/internal/k8sclient"
+	"k8s.io/client-go/rest"
+)
+
+// APIServerClockResolution is the uncertainty of the API server clock offset.
+const APIServerClockResolution = time.Second
+
+// APIServerClockOffset estimates the offset of the API server's clock from
+// the local one, using the Date header of an API server response. The header
+// has a one second resolution, so is the estimate.
+func APIServerClockOffset() (time.Duration, error) {
+	config, err := k8sclient.RESTConfig()
+	if err != nil {
+		return 0, err
+	}
+
+	client, err := rest.HTTPClientFor(config)
+	if err != nil {
+		return 0, err
+	}
+
+	serverURL, _, err := rest.DefaultServerUrlFor(config)
+	if err != nil {
+		return 0, err
+	}
+	serverURL.Path = "/version"
+
+	requested := time.Now()
+	res, err := client.Get(serverURL.String())
+	responded := time.Now()
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	date, err := http.ParseTime(res.Header.Get("Date"))
+	if err != nil {
+		return 0, fmt.Errorf("could not parse the API server Date header %q: %v", res.Header.Get("Date"), err)
+	}
+
+	// the header is truncated to the second, the server time is on average
+	// half a second later
+	date = date.Add(500 * time.Millisecond)
+
+	return date.Sub(requested.Add(responded.Sub(requested) / 2)), nil
+}
@@ -28,7 +28,7 @@ func ShowClusterVersion() (version string, err error) {
 		return "", err
 	}
 
-	isOpenShift, ocpVersion, err := isOpenShift()
+	isOpenShift, ocpVersion, err := IsOpenShift()
 	if err != nil {
 		return "", err
 	}
@@ -40,7 +40,7 @@ func ShowClusterVersion() (version string, err error) {
 	return ver.String(), nil
 }
 
-func isOpenShift() (bool, string, error) {
+func IsOpenShift() (bool, string, error) {
 	dclient, err := k8sclient.DynamicClient()
 	if err != nil {
 		return false, "", err
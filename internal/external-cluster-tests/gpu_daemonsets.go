@@ -0,0 +1,164 @@
+package external_cluster_tests
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/run-ai/preinstall-diagnostics/internal/k8sclient"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// Matched as substrings, the GPU Operator names them
+	// nvidia-device-plugin-daemonset and nvidia-dcgm-exporter
+	nvidiaDevicePluginDaemonset = "nvidia-device-plugin"
+	dcgmExporterDaemonset       = "dcgm-exporter"
+
+	nvidiaResourcePrefix = "nvidia.com/"
+)
+
+// WorkloadHealth is the rollout state of a DaemonSet or Deployment.
+type WorkloadHealth struct {
+	Namespace string
+	Name      string
+	Desired   int32
+	Ready     int32
+}
+
+func (h WorkloadHealth) String() string {
+	return fmt.Sprintf("%s/%s: %d/%d pods ready", h.Namespace, h.Name, h.Ready, h.Desired)
+}
+
+// Healthy tells whether all the pods of the workload are ready.
+func (h WorkloadHealth) Healthy() bool {
+	return h.Ready >= h.Desired
+}
+
+// DevicePluginHealth returns the state of the NVIDIA device plugin DaemonSets
+// of all namespaces.
+func DevicePluginHealth() ([]WorkloadHealth, error) {
+	return daemonSetsHealth(nvidiaDevicePluginDaemonset)
+}
+
+// DCGMExporterHealth returns the state of the DCGM exporter DaemonSets of all
+// namespaces.
+func DCGMExporterHealth() ([]WorkloadHealth, error) {
+	return daemonSetsHealth(dcgmExporterDaemonset)
+}
+
+func daemonSetsHealth(name string) ([]WorkloadHealth, error) {
+	k8s, err := k8sclient.ClientSet()
+	if err != nil {
+		return nil, err
+	}
+
+	daemonSets, err := findDaemonSets(k8s, name)
+	if err != nil {
+		return nil, err
+	}
+
+	health := []WorkloadHealth{}
+	for _, ds := range daemonSets {
+		health = append(health, WorkloadHealth{
+			Namespace: ds.Namespace,
+			Name:      ds.Name,
+			Desired:   ds.Status.DesiredNumberScheduled,
+			Ready:     ds.Status.NumberReady,
+		})
+	}
+
+	return health, nil
+}
+
+// GPUNodesWithoutDevicePlugin returns the reasons why every GPU node lacking
+// a ready device plugin pod or allocatable NVIDIA GPUs cannot run GPU
+// workloads, along with the number of GPU nodes.
+func GPUNodesWithoutDevicePlugin() (map[string][]string, int, error) {
+	k8s, err := k8sclient.ClientSet()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	nodes, err := gpuNodes(k8s)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	daemonSets, err := findDaemonSets(k8s, nvidiaDevicePluginDaemonset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	readyNodes := map[string]struct{}{}
+	for _, ds := range daemonSets {
+		selector, err := metav1.LabelSelectorAsSelector(ds.Spec.Selector)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		pods, err := k8s.CoreV1().Pods(ds.Namespace).List(context.TODO(), metav1.ListOptions{
+			LabelSelector: selector.String(),
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+
+		for _, pod := range pods.Items {
+			if podReady(pod) {
+				readyNodes[pod.Spec.NodeName] = struct{}{}
+			}
+		}
+	}
+
+	issues := map[string][]string{}
+	for _, node := range nodes {
+		if _, found := readyNodes[node.Name]; !found {
+			issues[node.Name] = append(issues[node.Name], "no ready device plugin pod")
+		}
+
+		if nvidiaGPUs(node.Status.Allocatable) == 0 {
+			issues[node.Name] = append(issues[node.Name], "no allocatable nvidia.com/gpu")
+		}
+	}
+
+	return issues, len(nodes), nil
+}
+
+func findDaemonSets(k8s *kubernetes.Clientset, name string) ([]appsv1.DaemonSet, error) {
+	daemonSets, err := k8s.AppsV1().DaemonSets(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	found := []appsv1.DaemonSet{}
+	for _, ds := range daemonSets.Items {
+		if strings.Contains(ds.Name, name) {
+			found = append(found, ds)
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].Namespace+"/"+found[i].Name < found[j].Namespace+"/"+found[j].Name
+	})
+
+	return found, nil
+}
+
+func podReady(pod v1.Pod) bool {
+	if pod.Status.Phase != v1.PodRunning {
+		return false
+	}
+
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,350 @@
+package external_cluster_tests
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/run-ai/preinstall-diagnostics/internal/k8sclient"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	gpuOperatorDeployment     = "gpu-operator"
+	gpuOperatorComponentLabel = "app.kubernetes.io/component"
+	gpuOperatorValidatorLabel = "app=nvidia-operator-validator"
+	// Name of the GPU Operator package in the OpenShift OperatorHub
+	gpuOperatorOLMPackage = "gpu-operator-certified"
+
+	clusterPolicyStateReady = "ready"
+	csvPhaseSucceeded       = "Succeeded"
+)
+
+var (
+	clusterPolicyGVR = schema.GroupVersionResource{
+		Group:    "nvidia.com",
+		Version:  "v1",
+		Resource: "clusterpolicies",
+	}
+	subscriptionGVR = schema.GroupVersionResource{
+		Group:    "operators.coreos.com",
+		Version:  "v1alpha1",
+		Resource: "subscriptions",
+	}
+	clusterServiceVersionGVR = schema.GroupVersionResource{
+		Group:    "operators.coreos.com",
+		Version:  "v1alpha1",
+		Resource: "clusterserviceversions",
+	}
+
+	// ClusterPolicy spec fields of the reported components
+	gpuOperatorComponents = []struct {
+		name  string
+		field string
+	}{
+		{"driver", "driver"},
+		{"toolkit", "toolkit"},
+		{"device plugin", "devicePlugin"},
+		{"DCGM exporter", "dcgmExporter"},
+		{"MIG manager", "migManager"},
+	}
+)
+
+// GPUOperatorStatus is the state of the NVIDIA GPU Operator installation.
+type GPUOperatorStatus struct {
+	// Empty when the operator is not deployed
+	Namespace  string
+	Deployment WorkloadHealth
+	Version    string
+
+	// Empty when there is no ClusterPolicy
+	ClusterPolicy      string
+	ClusterPolicyState string
+	Components         []GPUOperatorComponent
+
+	// Validator pod state of every node it runs on
+	Validations map[string]string
+
+	// Set on OpenShift when the operator is installed through OLM
+	OLM *OLMStatus
+}
+
+// GPUOperatorComponent is a component deployed by the ClusterPolicy.
+type GPUOperatorComponent struct {
+	Name    string
+	Enabled bool
+	Version string
+}
+
+// OLMStatus is the state of an operator installed through OLM.
+type OLMStatus struct {
+	Subscription      string
+	SubscriptionState string
+	CSV               string
+	CSVPhase          string
+	CSVMessage        string
+}
+
+// Healthy tells whether the operator, its ClusterPolicy, validations and OLM
+// installation are all ready. A ClusterPolicy without an operator Deployment
+// is not healthy.
+func (s GPUOperatorStatus) Healthy() bool {
+	if s.Namespace == "" || !s.Deployment.Healthy() || s.ClusterPolicyState != clusterPolicyStateReady {
+		return false
+	}
+
+	for _, validation := range s.Validations {
+		if validation != "ready" {
+			return false
+		}
+	}
+
+	return s.OLM == nil || s.OLM.CSVPhase == csvPhaseSucceeded
+}
+
+// GPUOperator returns the state of the NVIDIA GPU Operator, or nil when it is
+// neither deployed nor has a ClusterPolicy.
+func GPUOperator(openShift bool) (*GPUOperatorStatus, error) {
+	k8s, err := k8sclient.ClientSet()
+	if err != nil {
+		return nil, err
+	}
+
+	dclient, err := k8sclient.DynamicClient()
+	if err != nil {
+		return nil, err
+	}
+
+	status := &GPUOperatorStatus{
+		Validations: map[string]string{},
+	}
+
+	deployments, err := k8s.AppsV1().Deployments(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, deployment := range deployments.Items {
+		if deployment.Name == gpuOperatorDeployment ||
+			deployment.Labels[gpuOperatorComponentLabel] == gpuOperatorDeployment {
+			setGPUOperatorDeployment(status, deployment)
+			break
+		}
+	}
+
+	err = setClusterPolicy(status, dclient)
+	if err != nil {
+		return nil, err
+	}
+
+	if status.Namespace == "" && status.ClusterPolicy == "" {
+		return nil, nil
+	}
+
+	if status.Namespace != "" {
+		validators, err := k8s.CoreV1().Pods(status.Namespace).List(context.TODO(), metav1.ListOptions{
+			LabelSelector: gpuOperatorValidatorLabel,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, pod := range validators.Items {
+			status.Validations[pod.Spec.NodeName] = validatorState(pod)
+		}
+	}
+
+	if openShift {
+		status.OLM, err = olmStatus(dclient, gpuOperatorOLMPackage)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return status, nil
+}
+
+func setGPUOperatorDeployment(status *GPUOperatorStatus, deployment appsv1.Deployment) {
+	status.Namespace = deployment.Namespace
+	status.Deployment = WorkloadHealth{
+		Namespace: deployment.Namespace,
+		Name:      deployment.Name,
+		Ready:     deployment.Status.ReadyReplicas,
+	}
+	if deployment.Spec.Replicas != nil {
+		status.Deployment.Desired = *deployment.Spec.Replicas
+	}
+
+	if len(deployment.Spec.Template.Spec.Containers) > 0 {
+		status.Version = imageTag(deployment.Spec.Template.Spec.Containers[0].Image)
+	}
+}
+
+func setClusterPolicy(status *GPUOperatorStatus, dclient dynamic.Interface) error {
+	policies, err := dclient.Resource(clusterPolicyGVR).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// the ClusterPolicy CRD is not installed
+			return nil
+		}
+		return err
+	}
+
+	if len(policies.Items) == 0 {
+		return nil
+	}
+
+	// the operator only reconciles a single ClusterPolicy
+	policy := policies.Items[0]
+	status.ClusterPolicy = policy.GetName()
+	status.ClusterPolicyState, _, _ = unstructured.NestedString(policy.Object, "status", "state")
+
+	for _, component := range gpuOperatorComponents {
+		enabled, found, _ := unstructured.NestedBool(policy.Object, "spec", component.field, "enabled")
+		version, _, _ := unstructured.NestedString(policy.Object, "spec", component.field, "version")
+
+		status.Components = append(status.Components, GPUOperatorComponent{
+			Name: component.name,
+			// components are enabled unless disabled explicitly
+			Enabled: enabled || !found,
+			Version: version,
+		})
+	}
+
+	return nil
+}
+
+// validatorState returns "ready", or the validation the validator pod is
+// stuck at.
+func validatorState(pod v1.Pod) string {
+	for _, container := range pod.Status.InitContainerStatuses {
+		terminated := container.State.Terminated
+		if terminated != nil && terminated.ExitCode == 0 {
+			continue
+		}
+
+		state := "waiting on " + container.Name
+		if container.State.Waiting != nil && container.State.Waiting.Reason != "" {
+			state += ": " + container.State.Waiting.Reason
+		} else if terminated != nil {
+			state += ": " + terminated.Reason
+		}
+		return state
+	}
+
+	if !podReady(pod) {
+		return string(pod.Status.Phase)
+	}
+
+	return "ready"
+}
+
+// olmStatus returns the state of the Subscription to the package, nil when
+// there is none.
+func olmStatus(dclient dynamic.Interface, packageName string) (*OLMStatus, error) {
+	subscriptions, err := dclient.Resource(subscriptionGVR).Namespace(metav1.NamespaceAll).
+		List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	for _, subscription := range subscriptions.Items {
+		name, _, _ := unstructured.NestedString(subscription.Object, "spec", "name")
+		if name != packageName {
+			continue
+		}
+
+		status := &OLMStatus{
+			Subscription: subscription.GetNamespace() + "/" + subscription.GetName(),
+		}
+		status.SubscriptionState, _, _ = unstructured.NestedString(subscription.Object, "status", "state")
+		status.CSV, _, _ = unstructured.NestedString(subscription.Object, "status", "installedCSV")
+		if status.CSV == "" {
+			return status, nil
+		}
+
+		csv, err := dclient.Resource(clusterServiceVersionGVR).Namespace(subscription.GetNamespace()).
+			Get(context.TODO(), status.CSV, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		status.CSVPhase, _, _ = unstructured.NestedString(csv.Object, "status", "phase")
+		status.CSVMessage, _, _ = unstructured.NestedString(csv.Object, "status", "message")
+
+		return status, nil
+	}
+
+	return nil, nil
+}
+
+// String describes the status over multiple lines.
+func (s GPUOperatorStatus) String() string {
+	lines := []string{}
+
+	if s.Namespace != "" {
+		lines = append(lines, fmt.Sprintf("deployment %s, version %s", s.Deployment, s.Version))
+	} else {
+		lines = append(lines, "operator deployment not found")
+	}
+
+	if s.ClusterPolicy != "" {
+		lines = append(lines, fmt.Sprintf("ClusterPolicy %s: %s", s.ClusterPolicy, s.ClusterPolicyState))
+		for _, component := range s.Components {
+			if !component.Enabled {
+				lines = append(lines, component.Name+": disabled")
+			} else if component.Version != "" {
+				lines = append(lines, component.Name+": "+component.Version)
+			} else {
+				lines = append(lines, component.Name+": enabled")
+			}
+		}
+	} else {
+		lines = append(lines, "no ClusterPolicy, the operator deploys nothing")
+	}
+
+	nodeNames := []string{}
+	for nodeName := range s.Validations {
+		nodeNames = append(nodeNames, nodeName)
+	}
+	sort.Strings(nodeNames)
+	for _, nodeName := range nodeNames {
+		lines = append(lines, fmt.Sprintf("validator on %s: %s", nodeName, s.Validations[nodeName]))
+	}
+
+	if s.OLM != nil {
+		olm := fmt.Sprintf("OLM Subscription %s: %s", s.OLM.Subscription, s.OLM.SubscriptionState)
+		if s.OLM.CSV != "" {
+			olm += fmt.Sprintf(", CSV %s: %s", s.OLM.CSV, s.OLM.CSVPhase)
+		}
+		if s.OLM.CSVPhase != csvPhaseSucceeded && s.OLM.CSVMessage != "" {
+			olm += " (" + s.OLM.CSVMessage + ")"
+		}
+		lines = append(lines, olm)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func imageTag(image string) string {
+	image = image[strings.LastIndex(image, "/")+1:]
+	if digest := strings.Index(image, "@"); digest >= 0 {
+		return image[digest+1:]
+	}
+
+	_, tag, found := strings.Cut(image, ":")
+	if !found {
+		return "latest"
+	}
+
+	return tag
+}
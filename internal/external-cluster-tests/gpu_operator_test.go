@@ -0,0 +1,73 @@
+package external_cluster_tests
+
+import "testing"
+
+func TestGPUOperatorStatusHealthy(t *testing.T) {
+	deployment := WorkloadHealth{Namespace: "gpu-operator", Name: gpuOperatorDeployment, Desired: 1, Ready: 1}
+
+	tests := []struct {
+		name   string
+		status GPUOperatorStatus
+		want   bool
+	}{
+		{
+			name: "ready",
+			status: GPUOperatorStatus{
+				Namespace:          "gpu-operator",
+				Deployment:         deployment,
+				ClusterPolicy:      "cluster-policy",
+				ClusterPolicyState: clusterPolicyStateReady,
+				Validations:        map[string]string{"gpu-1": "ready"},
+			},
+			want: true,
+		},
+		{
+			name: "cluster policy without operator",
+			status: GPUOperatorStatus{
+				ClusterPolicy:      "cluster-policy",
+				ClusterPolicyState: clusterPolicyStateReady,
+			},
+			want: false,
+		},
+		{
+			name: "operator pods not ready",
+			status: GPUOperatorStatus{
+				Namespace:          "gpu-operator",
+				Deployment:         WorkloadHealth{Namespace: "gpu-operator", Name: gpuOperatorDeployment, Desired: 1},
+				ClusterPolicy:      "cluster-policy",
+				ClusterPolicyState: clusterPolicyStateReady,
+			},
+			want: false,
+		},
+		{
+			name: "validation not ready",
+			status: GPUOperatorStatus{
+				Namespace:          "gpu-operator",
+				Deployment:         deployment,
+				ClusterPolicy:      "cluster-policy",
+				ClusterPolicyState: clusterPolicyStateReady,
+				Validations:        map[string]string{"gpu-1": "ready", "gpu-2": "pending"},
+			},
+			want: false,
+		},
+		{
+			name: "CSV not succeeded",
+			status: GPUOperatorStatus{
+				Namespace:          "gpu-operator",
+				Deployment:         deployment,
+				ClusterPolicy:      "cluster-policy",
+				ClusterPolicyState: clusterPolicyStateReady,
+				OLM:                &OLMStatus{CSVPhase: "Installing"},
+			},
+			want: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.status.Healthy(); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
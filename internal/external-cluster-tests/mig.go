@@ -0,0 +1,214 @@
+package external_cluster_tests
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/run-ai/preinstall-diagnostics/internal/k8sclient"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	migCapableLabel     = "nvidia.com/mig.capable"
+	migConfigLabel      = "nvidia.com/mig.config"
+	migConfigStateLabel = "nvidia.com/mig.config.state"
+
+	migStrategyNone   = "none"
+	migStrategySingle = "single"
+	migStrategyMixed  = "mixed"
+
+	migConfigAllDisabled = "all-disabled"
+
+	migConfigStateFailed    = "failed"
+	migConfigStatePending   = "pending"
+	migConfigStateRebooting = "rebooting"
+
+	// The feature discovery appends e.g. -MIG-1g.5gb to the product of the
+	// GPUs of nodes with the single strategy
+	migProductInfix = "-MIG-"
+
+	migModeDisabled = "disabled"
+)
+
+// MIGNodeState is the MIG configuration of a GPU node, from its labels and
+// advertised resources.
+type MIGNodeState struct {
+	Node string
+	// GPU product without the MIG profile, nodes of the same product are
+	// expected to share a MIG strategy
+	Pool        string
+	Strategy    string
+	Config      string
+	ConfigState string
+	// disabled, single or mixed, as advertised by the device plugin
+	Mode         string
+	MIGResources []string
+}
+
+func (s MIGNodeState) String() string {
+	str := fmt.Sprintf("%s: MIG %s", s.Node, s.Mode)
+	if s.Strategy != "" {
+		str += ", strategy " + s.Strategy
+	}
+	if s.Config != "" {
+		str += ", config " + s.Config
+		if s.ConfigState != "" {
+			str += " (" + s.ConfigState + ")"
+		}
+	}
+	if len(s.MIGResources) > 0 {
+		str += ", " + strings.Join(s.MIGResources, " ")
+	}
+
+	return str
+}
+
+// MIGReport is the MIG configuration of the GPU nodes and its
+// inconsistencies.
+type MIGReport struct {
+	Nodes    []MIGNodeState
+	Failures []string
+	Warnings []string
+}
+
+// MIGConsistency checks the MIG configuration of the GPU nodes of the cluster.
+func MIGConsistency() (MIGReport, error) {
+	k8s, err := k8sclient.ClientSet()
+	if err != nil {
+		return MIGReport{}, err
+	}
+
+	nodes, err := gpuNodes(k8s)
+	if err != nil {
+		return MIGReport{}, err
+	}
+
+	return CheckMIGConsistency(nodes), nil
+}
+
+// CheckMIGConsistency reports the MIG configuration of the nodes relying on
+// MIG: failed or pending mig-manager configurations, advertised resources not
+// matching the MIG labels and different MIG strategies for the same GPU
+// product. Nodes neither MIG capable nor configured are left out.
+func CheckMIGConsistency(nodes []v1.Node) MIGReport {
+	report := MIGReport{}
+	strategiesByPool := map[string]map[string][]string{}
+
+	for _, node := range nodes {
+		state := migNodeState(node)
+		// the feature discovery sets the MIG strategy on every GPU node
+		if node.Labels[migCapableLabel] != "true" && state.Config == "" && state.Mode == migModeDisabled {
+			continue
+		}
+		report.Nodes = append(report.Nodes, state)
+
+		switch state.ConfigState {
+		case migConfigStateFailed:
+			report.Failures = append(report.Failures,
+				fmt.Sprintf("%s: mig-manager failed to apply MIG config %s", state.Node, state.Config))
+		case migConfigStatePending, migConfigStateRebooting:
+			report.Warnings = append(report.Warnings,
+				fmt.Sprintf("%s: MIG config %s is %s", state.Node, state.Config, state.ConfigState))
+		}
+
+		mismatch := migMismatch(state)
+		if mismatch != "" {
+			report.Failures = append(report.Failures, state.Node+": "+mismatch)
+		}
+
+		if state.Strategy != "" {
+			if strategiesByPool[state.Pool] == nil {
+				strategiesByPool[state.Pool] = map[string][]string{}
+			}
+			strategiesByPool[state.Pool][state.Strategy] = append(strategiesByPool[state.Pool][state.Strategy],
+				state.Node)
+		}
+	}
+
+	pools := []string{}
+	for pool := range strategiesByPool {
+		pools = append(pools, pool)
+	}
+	sort.Strings(pools)
+
+	for _, pool := range pools {
+		if len(strategiesByPool[pool]) < 2 {
+			continue
+		}
+
+		strategies := []string{}
+		for strategy, nodeNames := range strategiesByPool[pool] {
+			strategies = append(strategies, fmt.Sprintf("%s on %s", strategy, strings.Join(nodeNames, ", ")))
+		}
+		sort.Strings(strategies)
+
+		report.Failures = append(report.Failures,
+			fmt.Sprintf("%s nodes use different MIG strategies: %s", pool, strings.Join(strategies, "; ")))
+	}
+
+	return report
+}
+
+func migNodeState(node v1.Node) MIGNodeState {
+	state := MIGNodeState{
+		Node:        node.Name,
+		Pool:        node.Labels[gpuProductLabel],
+		Strategy:    node.Labels[migStrategyLabel],
+		Config:      node.Labels[migConfigLabel],
+		ConfigState: node.Labels[migConfigStateLabel],
+		Mode:        migModeDisabled,
+	}
+
+	if pool, _, found := strings.Cut(state.Pool, migProductInfix); found {
+		state.Pool = pool
+		state.Mode = migStrategySingle
+	}
+	if state.Pool == "" {
+		state.Pool = unknownGPUProduct
+	}
+
+	for name, quantity := range node.Status.Capacity {
+		resource, found := strings.CutPrefix(string(name), nvidiaResourcePrefix)
+		if found && strings.HasPrefix(resource, "mig-") && !quantity.IsZero() {
+			state.MIGResources = append(state.MIGResources, fmt.Sprintf("%s=%s", name, quantity.String()))
+		}
+	}
+	sort.Strings(state.MIGResources)
+
+	if len(state.MIGResources) > 0 {
+		state.Mode = migStrategyMixed
+	}
+
+	return state
+}
+
+// migMismatch describes how the advertised MIG devices contradict the MIG
+// labels of the node, empty when they agree.
+func migMismatch(state MIGNodeState) string {
+	// devices are advertised again once the mig-manager is done
+	if state.ConfigState == migConfigStatePending || state.ConfigState == migConfigStateRebooting {
+		return ""
+	}
+
+	migEnabled := state.Config != "" && state.Config != migConfigAllDisabled
+
+	switch {
+	case state.Mode == migStrategyMixed && state.Strategy != migStrategyMixed:
+		return fmt.Sprintf("advertises %s but the MIG strategy is %q", strings.Join(state.MIGResources, " "),
+			state.Strategy)
+	case state.Mode == migStrategySingle && state.Strategy != migStrategySingle:
+		return fmt.Sprintf("advertises MIG devices as nvidia.com/gpu but the MIG strategy is %q", state.Strategy)
+	case state.Mode != migModeDisabled && state.Config == migConfigAllDisabled:
+		return "advertises MIG devices although MIG config is " + migConfigAllDisabled
+	case state.Mode == migModeDisabled && migEnabled &&
+		(state.Strategy == migStrategySingle || state.Strategy == migStrategyMixed):
+		return fmt.Sprintf("MIG config is %s with the %s strategy but no MIG devices are advertised",
+			state.Config, state.Strategy)
+	case state.Mode == migModeDisabled && migEnabled && (state.Strategy == migStrategyNone || state.Strategy == ""):
+		return fmt.Sprintf("MIG config is %s but the MIG strategy is %q, the MIG devices are not advertised",
+			state.Config, state.Strategy)
+	}
+
+	return ""
+}
@@ -0,0 +1,167 @@
+package external_cluster_tests
+
+import (
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func gpuNode(name string, labels map[string]string, capacity map[string]string) v1.Node {
+	node := v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: labels,
+		},
+		Status: v1.NodeStatus{
+			Capacity: v1.ResourceList{},
+		},
+	}
+	for name, quantity := range capacity {
+		node.Status.Capacity[v1.ResourceName(name)] = resource.MustParse(quantity)
+	}
+
+	return node
+}
+
+func TestCheckMIGConsistency(t *testing.T) {
+	tests := []struct {
+		name         string
+		nodes        []v1.Node
+		wantNodes    []string
+		wantFailures []string
+		wantWarnings []string
+	}{
+		{
+			name: "failed config",
+			nodes: []v1.Node{
+				gpuNode("gpu-1", map[string]string{
+					gpuProductLabel:     "NVIDIA-A100-SXM4-40GB",
+					migCapableLabel:     "true",
+					migStrategyLabel:    migStrategyMixed,
+					migConfigLabel:      "all-1g.5gb",
+					migConfigStateLabel: migConfigStateFailed,
+				}, map[string]string{"nvidia.com/gpu": "8"}),
+			},
+			wantNodes: []string{"gpu-1"},
+			wantFailures: []string{
+				"gpu-1: mig-manager failed to apply MIG config all-1g.5gb",
+				"gpu-1: MIG config is all-1g.5gb with the mixed strategy but no MIG devices are advertised",
+			},
+		},
+		{
+			name: "pending config",
+			nodes: []v1.Node{
+				gpuNode("gpu-1", map[string]string{
+					gpuProductLabel:     "NVIDIA-A100-SXM4-40GB",
+					migCapableLabel:     "true",
+					migStrategyLabel:    migStrategyMixed,
+					migConfigLabel:      "all-1g.5gb",
+					migConfigStateLabel: migConfigStatePending,
+				}, map[string]string{"nvidia.com/gpu": "8"}),
+			},
+			wantNodes:    []string{"gpu-1"},
+			wantWarnings: []string{"gpu-1: MIG config all-1g.5gb is pending"},
+		},
+		{
+			name: "single strategy",
+			nodes: []v1.Node{
+				gpuNode("gpu-1", map[string]string{
+					gpuProductLabel:     "NVIDIA-A100-SXM4-40GB-MIG-1g.5gb",
+					migCapableLabel:     "true",
+					migStrategyLabel:    migStrategySingle,
+					migConfigLabel:      "all-1g.5gb",
+					migConfigStateLabel: "success",
+				}, map[string]string{"nvidia.com/gpu": "56"}),
+			},
+			wantNodes: []string{"gpu-1"},
+		},
+		{
+			name: "mixed strategy",
+			nodes: []v1.Node{
+				gpuNode("gpu-1", map[string]string{
+					gpuProductLabel:     "NVIDIA-A100-SXM4-40GB",
+					migCapableLabel:     "true",
+					migStrategyLabel:    migStrategyMixed,
+					migConfigLabel:      "all-balanced",
+					migConfigStateLabel: "success",
+				}, map[string]string{
+					"nvidia.com/gpu":         "0",
+					"nvidia.com/mig-1g.5gb":  "16",
+					"nvidia.com/mig-2g.10gb": "8",
+					"nvidia.com/mig-3g.20gb": "8",
+				}),
+			},
+			wantNodes: []string{"gpu-1"},
+		},
+		{
+			name: "all-disabled config advertising MIG devices",
+			nodes: []v1.Node{
+				gpuNode("gpu-1", map[string]string{
+					gpuProductLabel:     "NVIDIA-A100-SXM4-40GB",
+					migCapableLabel:     "true",
+					migStrategyLabel:    migStrategyMixed,
+					migConfigLabel:      migConfigAllDisabled,
+					migConfigStateLabel: "success",
+				}, map[string]string{"nvidia.com/mig-1g.5gb": "7"}),
+			},
+			wantNodes:    []string{"gpu-1"},
+			wantFailures: []string{"gpu-1: advertises MIG devices although MIG config is all-disabled"},
+		},
+		{
+			name: "two strategies in one pool",
+			nodes: []v1.Node{
+				gpuNode("gpu-1", map[string]string{
+					gpuProductLabel:  "NVIDIA-A100-SXM4-40GB-MIG-1g.5gb",
+					migCapableLabel:  "true",
+					migStrategyLabel: migStrategySingle,
+					migConfigLabel:   "all-1g.5gb",
+				}, map[string]string{"nvidia.com/gpu": "56"}),
+				gpuNode("gpu-2", map[string]string{
+					gpuProductLabel:  "NVIDIA-A100-SXM4-40GB",
+					migCapableLabel:  "true",
+					migStrategyLabel: migStrategyMixed,
+					migConfigLabel:   "all-1g.5gb",
+				}, map[string]string{"nvidia.com/mig-1g.5gb": "56"}),
+			},
+			wantNodes: []string{"gpu-1", "gpu-2"},
+			wantFailures: []string{
+				"NVIDIA-A100-SXM4-40GB nodes use different MIG strategies: mixed on gpu-2; single on gpu-1",
+			},
+		},
+		{
+			name: "non-MIG GPU node",
+			nodes: []v1.Node{
+				gpuNode("gpu-1", map[string]string{
+					gpuProductLabel:  "Tesla-T4",
+					migCapableLabel:  "false",
+					migStrategyLabel: migStrategySingle,
+				}, map[string]string{"nvidia.com/gpu": "1"}),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report := CheckMIGConsistency(test.nodes)
+
+			nodes := []string{}
+			for _, state := range report.Nodes {
+				nodes = append(nodes, state.Node)
+			}
+			assertLines(t, "nodes", nodes, test.wantNodes)
+			assertLines(t, "failures", report.Failures, test.wantFailures)
+			assertLines(t, "warnings", report.Warnings, test.wantWarnings)
+		})
+	}
+}
+
+func assertLines(t *testing.T, name string, got []string, want []string) {
+	t.Helper()
+
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("%s:\ngot  %q\nwant %q", name, got, want)
+	}
+}
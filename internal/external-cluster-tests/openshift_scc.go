@@ -0,0 +1,93 @@
+package external_cluster_tests
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	securityv1 "github.com/openshift/api/security/v1"
+	"github.com/run-ai/preinstall-diagnostics/internal/k8sclient"
+	"github.com/run-ai/preinstall-diagnostics/internal/resources"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+const (
+	sccAdmissionPollInterval = 5 * time.Second
+
+	failedCreateReason = "FailedCreate"
+	jobNameLabel       = "job-name"
+)
+
+// SCCAdmission waits for the pods of the run to be created and returns, per
+// job, why its pod was not admitted with the dedicated SCC of the run.
+func SCCAdmission(names resources.Names, timeout time.Duration) (map[string]string, error) {
+	k8s, err := k8sclient.ClientSet()
+	if err != nil {
+		return nil, err
+	}
+
+	sccName := names.ForRun()
+
+	for ; ; timeout -= sccAdmissionPollInterval {
+		jobs, err := k8s.BatchV1().Jobs(names.Namespace).List(context.TODO(), metav1.ListOptions{
+			LabelSelector: names.RunSelector(),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		pods, err := k8s.CoreV1().Pods(names.Namespace).List(context.TODO(), metav1.ListOptions{
+			LabelSelector: names.RunSelector(),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		admittedSCCs := map[string]string{}
+		for _, pod := range pods.Items {
+			admittedSCCs[pod.Labels[jobNameLabel]] = pod.Annotations[securityv1.ValidatedSCCAnnotation]
+		}
+
+		pending := false
+		failures := map[string]string{}
+
+		for _, job := range jobs.Items {
+			scc, created := admittedSCCs[job.Name]
+			if created {
+				if scc != sccName {
+					failures[job.Name] = fmt.Sprintf("admitted with SCC %q", scc)
+				}
+				continue
+			}
+
+			events, err := k8s.CoreV1().Events(names.Namespace).List(context.TODO(), metav1.ListOptions{
+				FieldSelector: fields.Set{
+					"involvedObject.name": job.Name,
+					"reason":              failedCreateReason,
+				}.String(),
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			if len(events.Items) > 0 {
+				failures[job.Name] = events.Items[len(events.Items)-1].Message
+				continue
+			}
+
+			if timeout <= 0 {
+				failures[job.Name] = "no pod was created"
+				continue
+			}
+
+			pending = true
+		}
+
+		if !pending {
+			return failures, nil
+		}
+
+		time.Sleep(sccAdmissionPollInterval)
+	}
+}
@@ -0,0 +1,155 @@
+package external_cluster_tests
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"regexp"
+
+	"github.com/run-ai/preinstall-diagnostics/internal/k8sclient"
+	"github.com/run-ai/preinstall-diagnostics/internal/probe"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// Outside of any sane service CIDR, so that allocating it fails and the
+	// API server reports the valid range
+	probeClusterIP = "1.1.1.1"
+)
+
+var (
+	serviceCIDRRegexp = regexp.MustCompile(`valid IPs is (\S+)`)
+)
+
+// NoProxyUncovered returns the in-cluster destinations which the agents
+// would reach through the proxy, as they are not covered by NO_PROXY.
+func NoProxyUncovered() ([]string, error) {
+	if !probe.ProxyConfigured() {
+		return nil, nil
+	}
+
+	destinations, err := inClusterDestinations()
+	if err != nil {
+		return nil, err
+	}
+
+	uncovered := []string{}
+	for _, destination := range destinations {
+		u, err := url.Parse(destination)
+		if err != nil {
+			return nil, err
+		}
+
+		proxyURL, err := probe.ProxyForURL(u)
+		if err != nil {
+			return nil, err
+		}
+
+		if proxyURL != nil {
+			uncovered = append(uncovered, u.Host)
+		}
+	}
+
+	return uncovered, nil
+}
+
+func inClusterDestinations() ([]string, error) {
+	conf, err := k8sclient.RESTConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	k8s, err := k8sclient.ClientSet()
+	if err != nil {
+		return nil, err
+	}
+
+	kubernetesSvc, err := k8s.CoreV1().Services(metav1.NamespaceDefault).
+		Get(context.TODO(), "kubernetes", metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	destinations := []string{
+		conf.Host,
+		"https://" + net.JoinHostPort(kubernetesSvc.Spec.ClusterIP, "443"),
+		"https://kubernetes.default.svc",
+	}
+
+	serviceCIDR, err := ServiceCIDR()
+	if err != nil {
+		return nil, err
+	}
+
+	if serviceCIDR != nil {
+		destinations = append(destinations,
+			"https://"+net.JoinHostPort(lastAddress(serviceCIDR).String(), "443"))
+	}
+
+	return destinations, nil
+}
+
+// ServiceCIDR finds the service IP range by asking the API server to
+// allocate an IP outside of it in a dry run, nil is returned when the range
+// could not be determined.
+func ServiceCIDR() (*net.IPNet, error) {
+	k8s, err := k8sclient.ClientSet()
+	if err != nil {
+		return nil, err
+	}
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "runai-diagnostics-cidr-probe-",
+		},
+		Spec: v1.ServiceSpec{
+			ClusterIP: probeClusterIP,
+			Ports: []v1.ServicePort{
+				{
+					Port: 443,
+				},
+			},
+		},
+	}
+
+	_, err = k8s.CoreV1().Services(metav1.NamespaceDefault).Create(context.TODO(), svc,
+		metav1.CreateOptions{
+			DryRun: []string{metav1.DryRunAll},
+		})
+	if err == nil {
+		return nil, nil
+	}
+
+	match := serviceCIDRRegexp.FindStringSubmatch(err.Error())
+	if match == nil {
+		return nil, nil
+	}
+
+	_, cidr, err := net.ParseCIDR(match[1])
+	if err != nil {
+		return nil, fmt.Errorf("could not parse service CIDR %s: %v", match[1], err)
+	}
+
+	return cidr, nil
+}
+
+func lastAddress(cidr *net.IPNet) net.IP {
+	ip := cidr.IP.To4()
+	if ip == nil {
+		ip = cidr.IP.To16()
+	}
+
+	last := new(big.Int).SetBytes(ip)
+	ones, bits := cidr.Mask.Size()
+	hostBits := new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+	last.Add(last, hostBits.Sub(hostBits, big.NewInt(1)))
+
+	b := last.Bytes()
+	out := make(net.IP, len(ip))
+	copy(out[len(out)-len(b):], b)
+
+	return out
+}
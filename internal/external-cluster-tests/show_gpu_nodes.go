@@ -6,11 +6,30 @@ import (
 	"github.com/run-ai/preinstall-diagnostics/internal/k8sclient"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
 	"strings"
 )
 
+const (
+	nvidiaGPUResource = v1.ResourceName(nvidiaResourcePrefix + "gpu")
+
+	gpuProductLabel   = "nvidia.com/gpu.product"
+	gpuCountLabel     = "nvidia.com/gpu.count"
+	gpuMemoryLabel    = "nvidia.com/gpu.memory"
+	gpuComputeMajor   = "nvidia.com/gpu.compute.major"
+	gpuComputeMinor   = "nvidia.com/gpu.compute.minor"
+	cudaDriverMajor   = "nvidia.com/cuda.driver.major"
+	cudaDriverMinor   = "nvidia.com/cuda.driver.minor"
+	cudaDriverRev     = "nvidia.com/cuda.driver.rev"
+	cudaRuntimeMajor  = "nvidia.com/cuda.runtime.major"
+	cudaRuntimeMinor  = "nvidia.com/cuda.runtime.minor"
+	migStrategyLabel  = "nvidia.com/mig.strategy"
+	unknownGPUProduct = "unknown"
+)
+
 var (
+	// Labels set by the NVIDIA GPU feature discovery, any of them marks a GPU
+	// node
 	nvidiaLabels = map[string]string{
 		"nvidia.com/cuda.driver.major":  "",
 		"nvidia.com/cuda.driver.minor":  "",
@@ -24,6 +43,7 @@ var (
 		"nvidia.com/gpu.family":         "",
 		"nvidia.com/gpu.machine":        "",
 		"nvidia.com/gpu.memory":         "",
+		"nvidia.com/gpu.present":        "",
 		"nvidia.com/gpu.product":        "",
 
 		// Not all of our custumers support MIG?
@@ -31,24 +51,191 @@ var (
 	}
 )
 
+// GPUNodeInventory describes the GPUs of a node from its labels and resources.
+type GPUNodeInventory struct {
+	Node        string
+	Product     string
+	Count       string
+	Memory      string
+	Compute     string
+	Driver      string
+	CUDA        string
+	MIGStrategy string
+	Allocatable int64
+	Allocated   int64
+}
+
 func ShowGPUNodes() ([]v1.Node, error) {
 	k8s, err := k8sclient.ClientSet()
 	if err != nil {
 		return nil, err
 	}
 
-	labelSelector := strings.ReplaceAll(labels.FormatLabels(nvidiaLabels), "=", "")
+	nodes, err := gpuNodes(k8s)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("No GPU nodes were found in the cluster")
+	}
+
+	return nodes, nil
+}
+
+// GPUInventory describes the GPUs of every GPU node and how many of them are
+// requested by running pods.
+func GPUInventory() ([]GPUNodeInventory, error) {
+	k8s, err := k8sclient.ClientSet()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := gpuNodes(k8s)
+	if err != nil {
+		return nil, err
+	}
 
-	nodes, err := k8s.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{
-		LabelSelector: labelSelector,
+	pods, err := k8s.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{
+		FieldSelector: "status.phase!=Succeeded,status.phase!=Failed",
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	if len(nodes.Items) == 0 {
-		return nil, fmt.Errorf("No GPU nodes were found in the cluster")
+	allocated := map[string]int64{}
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName != "" {
+			allocated[pod.Spec.NodeName] += podNVIDIAGPUs(pod)
+		}
+	}
+
+	inventory := []GPUNodeInventory{}
+	for _, node := range nodes {
+		labels := node.Labels
+
+		nodeInventory := GPUNodeInventory{
+			Node:        node.Name,
+			Product:     labels[gpuProductLabel],
+			Count:       labels[gpuCountLabel],
+			Memory:      labels[gpuMemoryLabel],
+			Compute:     joinLabels(labels, gpuComputeMajor, gpuComputeMinor),
+			Driver:      joinLabels(labels, cudaDriverMajor, cudaDriverMinor, cudaDriverRev),
+			CUDA:        joinLabels(labels, cudaRuntimeMajor, cudaRuntimeMinor),
+			MIGStrategy: labels[migStrategyLabel],
+			Allocatable: nvidiaGPUs(node.Status.Allocatable),
+			Allocated:   allocated[node.Name],
+		}
+
+		if nodeInventory.Product == "" {
+			nodeInventory.Product = unknownGPUProduct
+		}
+		if nodeInventory.Count == "" {
+			capacity := node.Status.Capacity[nvidiaGPUResource]
+			nodeInventory.Count = capacity.String()
+		}
+		if nodeInventory.Memory != "" {
+			nodeInventory.Memory += " MiB"
+		}
+
+		inventory = append(inventory, nodeInventory)
+	}
+
+	return inventory, nil
+}
+
+// gpuNodes returns the nodes advertising NVIDIA GPUs or labelled by the NVIDIA
+// GPU feature discovery.
+func gpuNodes(k8s *kubernetes.Clientset) ([]v1.Node, error) {
+	nodes, err := k8s.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	gpuNodes := []v1.Node{}
+	for _, node := range nodes.Items {
+		if isGPUNode(node) {
+			gpuNodes = append(gpuNodes, node)
+		}
+	}
+
+	return gpuNodes, nil
+}
+
+func isGPUNode(node v1.Node) bool {
+	if nvidiaGPUs(node.Status.Capacity) > 0 {
+		return true
+	}
+
+	for label := range nvidiaLabels {
+		if _, found := node.Labels[label]; found {
+			return true
+		}
+	}
+
+	return false
+}
+
+// nvidiaGPUs sums nvidia.com/gpu and, with the mixed MIG strategy,
+// nvidia.com/mig-* resources.
+func nvidiaGPUs(resources v1.ResourceList) int64 {
+	gpus := int64(0)
+	for name, quantity := range resources {
+		if isNVIDIAGPUResource(name) {
+			gpus += quantity.Value()
+		}
+	}
+
+	return gpus
+}
+
+func isNVIDIAGPUResource(name v1.ResourceName) bool {
+	resource, found := strings.CutPrefix(string(name), nvidiaResourcePrefix)
+	return found && (resource == "gpu" || strings.HasPrefix(resource, "mig-"))
+}
+
+// podNVIDIAGPUs returns the GPUs requested by the pod, extended resources are
+// requested through their limits.
+func podNVIDIAGPUs(pod v1.Pod) int64 {
+	containersGPUs := func(containers []v1.Container) []int64 {
+		gpus := []int64{}
+		for _, container := range containers {
+			requests := v1.ResourceList{}
+			for name, quantity := range container.Resources.Limits {
+				requests[name] = quantity
+			}
+			for name, quantity := range container.Resources.Requests {
+				requests[name] = quantity
+			}
+			gpus = append(gpus, nvidiaGPUs(requests))
+		}
+		return gpus
+	}
+
+	podGPUs := int64(0)
+	for _, gpus := range containersGPUs(pod.Spec.Containers) {
+		podGPUs += gpus
+	}
+
+	// init containers run one at a time, before the containers
+	for _, gpus := range containersGPUs(pod.Spec.InitContainers) {
+		podGPUs = max(podGPUs, gpus)
+	}
+
+	return podGPUs
+}
+
+// joinLabels joins the values of the labels with dots, empty if any is
+// missing.
+func joinLabels(labels map[string]string, keys ...string) string {
+	values := []string{}
+	for _, key := range keys {
+		value, found := labels[key]
+		if !found {
+			return ""
+		}
+		values = append(values, value)
 	}
 
-	return nodes.Items, nil
+	return strings.Join(values, ".")
 }
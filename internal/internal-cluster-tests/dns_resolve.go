@@ -4,20 +4,34 @@ import (
 	"context"
 	"fmt"
 	"github.com/run-ai/preinstall-diagnostics/internal/env"
-	"io"
+	"github.com/run-ai/preinstall-diagnostics/internal/mesh"
+	"github.com/run-ai/preinstall-diagnostics/internal/probe"
 	"net"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
-func DNSRecordsResolvable() (bool, error) {
+// DNSRecordsResolvable resolves the hostname of the configured Run:ai SaaS
+// address, or the backend FQDN when there is none, through public resolvers,
+// to tell issues of the cluster DNS from upstream issues.
+func DNSRecordsResolvable() (string, error) {
+	hostname, err := publicHostname()
+	if err != nil {
+		return "", err
+	}
+
 	externalDNSServers := []string{
 		"1.1.1.1:53",
 		"8.8.8.8:53",
 	}
 
+	lines := []string{}
 	for _, dnsServer := range externalDNSServers {
 		resolver := &net.Resolver{
+			PreferGo: true,
 			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
 				d := net.Dialer{
 					Timeout: time.Millisecond * time.Duration(10000),
@@ -26,18 +40,49 @@ func DNSRecordsResolvable() (bool, error) {
 			},
 		}
 
-		ip, err := resolver.LookupHost(context.Background(), RunAISaasHostname)
+		ip, err := resolver.LookupHost(context.Background(), hostname)
 		if err != nil {
-			return false, err
+			return "", err
 		}
 
 		if len(ip) == 0 {
-			return false, fmt.Errorf("no addresses resolved for [%s] by [%s]",
-				RunAISaasHostname, dnsServer)
+			return "", fmt.Errorf("no addresses resolved for [%s] by [%s]",
+				hostname, dnsServer)
+		}
+
+		lines = append(lines, fmt.Sprintf("%s: %s", dnsServer, strings.Join(ip, ", ")))
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// publicHostname returns the host to resolve through public resolvers.
+func publicHostname() (string, error) {
+	address := env.EnvOrDefault(env.RunAISaasEnvVar, "")
+	if address == "" {
+		backendFQDN := env.EnvOrDefault(env.BackendFQDNEnvVar, "")
+		if backendFQDN == "" {
+			return "", fmt.Errorf("neither a SaaS address nor a backend FQDN was provided")
+		}
+		return backendFQDN, nil
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", err
+	}
+	if u.Hostname() == "" {
+		// an address without a scheme
+		u, err = url.Parse("https://" + address)
+		if err != nil {
+			return "", err
 		}
 	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("no hostname in SaaS address %s", address)
+	}
 
-	return true, nil
+	return u.Hostname(), nil
 }
 
 func BackendFQDNResolvable() ([]net.IP, error) {
@@ -54,16 +99,157 @@ func BackendFQDNResolvable() ([]net.IP, error) {
 	return ips, nil
 }
 
+const (
+	resolvConfPath = "/etc/resolv.conf"
+
+	// The resolver's default without an ndots option, kubelet writes ndots:5
+	// for pods using the cluster DNS
+	defaultNdots = 1
+	// External names with fewer dots than ndots are first looked up in every
+	// search domain. kubelet's <namespace>.svc.<domain>, svc.<domain> and
+	// <domain> are expected, the warning is meant for the search domains of
+	// the node appended to them, each adding a failed lookup to every
+	// external name.
+	clusterSearchDomains = 3
+	// Search domains honoured by older libc versions
+	maxSearchDomains = 6
+
+	lookupAttempts = 10
+	// Lookups slower than this point at an overloaded or distant resolver
+	slowLookup = 500 * time.Millisecond
+)
+
+// ResolvConf holds the settings of a resolv.conf file relevant to lookups.
+type ResolvConf struct {
+	Nameservers []string
+	Search      []string
+	Ndots       int
+	Options     []string
+}
+
+func ParseResolvConf(content string) ResolvConf {
+	conf := ResolvConf{
+		Ndots: defaultNdots,
+	}
+
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], ";") {
+			continue
+		}
+
+		switch fields[0] {
+		case "nameserver":
+			conf.Nameservers = append(conf.Nameservers, fields[1])
+		case "search", "domain":
+			conf.Search = fields[1:]
+		case "options":
+			for _, option := range fields[1:] {
+				conf.Options = append(conf.Options, option)
+
+				value, found := strings.CutPrefix(option, "ndots:")
+				if !found {
+					continue
+				}
+				ndots, err := strconv.Atoi(value)
+				if err == nil {
+					conf.Ndots = ndots
+				}
+			}
+		}
+	}
+
+	return conf
+}
+
+// DNSResolvConf evaluates the DNS settings of the agent, which are those of
+// every pod using the cluster DNS. Known bad patterns are reported as
+// warnings, missing or unreachable nameservers as errors.
 func DNSResolvConf() (string, error) {
-	f, err := os.Open("/etc/resolv.conf")
+	content, err := os.ReadFile(resolvConfPath)
 	if err != nil {
 		return "", err
 	}
 
-	content, err := io.ReadAll(f)
-	if err != nil {
-		return "", err
+	conf := ParseResolvConf(string(content))
+
+	lines := []string{
+		fmt.Sprintf("nameservers: %s", strings.Join(conf.Nameservers, ", ")),
+		fmt.Sprintf("search: %s", strings.Join(conf.Search, ", ")),
+		fmt.Sprintf("options: %s", strings.Join(conf.Options, " ")),
+	}
+
+	if len(conf.Nameservers) == 0 {
+		return "", fmt.Errorf("no nameserver configured in %s", resolvConfPath)
+	}
+
+	if conf.Ndots > 1 && len(conf.Search) > clusterSearchDomains {
+		lines = append(lines, fmt.Sprintf("warning: with ndots:%d and %d search domains, %d of them inherited "+
+			"from the node, external names are looked up %d times before being resolved, which slows down "+
+			"external lookups", conf.Ndots, len(conf.Search), len(conf.Search)-clusterSearchDomains,
+			len(conf.Search)+1))
+	}
+
+	if len(conf.Search) > maxSearchDomains {
+		lines = append(lines, fmt.Sprintf("warning: %d search domains, older libc versions ignore all but the first %d",
+			len(conf.Search), maxSearchDomains))
+	}
+
+	unreachable := []string{}
+	for _, nameserver := range conf.Nameservers {
+		result, err := probe.UDP(net.JoinHostPort(nameserver, "53"), "", probe.DefaultOptions())
+		if err != nil {
+			unreachable = append(unreachable, nameserver)
+			lines = append(lines, fmt.Sprintf("nameserver %s is unreachable: %v", nameserver, err))
+		} else {
+			lines = append(lines, fmt.Sprintf("nameserver %s: %s", nameserver, result))
+		}
+	}
+
+	if len(unreachable) == len(conf.Nameservers) {
+		return "", fmt.Errorf("%s", strings.Join(lines, "\n"))
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// BackendFQDNLookupQuality looks the backend FQDN up repeatedly and reports
+// the lookup latency and failure rate.
+func BackendFQDNLookupQuality() (string, error) {
+	backendFQDN := env.EnvOrDefault(env.BackendFQDNEnvVar, "")
+	if backendFQDN == "" {
+		return "", fmt.Errorf("Backend FQDN was not provided using the --domain flag, skipping test")
+	}
+
+	latencies := []time.Duration{}
+	var lastErr error
+	for i := 0; i < lookupAttempts; i++ {
+		start := time.Now()
+		_, err := net.DefaultResolver.LookupIP(context.TODO(), "ip", backendFQDN)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		latencies = append(latencies, time.Since(start))
+	}
+
+	failures := lookupAttempts - len(latencies)
+	if len(latencies) == 0 {
+		return "", fmt.Errorf("all %d lookups of %s failed: %v", lookupAttempts, backendFQDN, lastErr)
+	}
+
+	p50 := mesh.Percentile(latencies, 50)
+	p90 := mesh.Percentile(latencies, 90)
+	message := fmt.Sprintf("%d/%d lookups of %s failed, latency p50 %s, p90 %s",
+		failures, lookupAttempts, backendFQDN, p50.Round(time.Microsecond), p90.Round(time.Microsecond))
+
+	if failures > 0 {
+		return "", fmt.Errorf("%s, last error: %v", message, lastErr)
+	}
+
+	if p90 > slowLookup {
+		message += "\nwarning: lookups are slow"
 	}
 
-	return string(content), nil
+	return message, nil
 }
@@ -0,0 +1,38 @@
+package internal_cluster_tests
+
+import (
+	"testing"
+
+	"github.com/run-ai/preinstall-diagnostics/internal/env"
+)
+
+func TestPublicHostname(t *testing.T) {
+	tests := []struct {
+		name        string
+		saasAddress string
+		backendFQDN string
+		want        string
+		wantErr     bool
+	}{
+		{name: "SaaS address", saasAddress: "https://tenant.run.ai", backendFQDN: "runai.example.com", want: "tenant.run.ai"},
+		{name: "SaaS address with port", saasAddress: "https://tenant.run.ai:8443/", want: "tenant.run.ai"},
+		{name: "SaaS address without scheme", saasAddress: "tenant.run.ai", want: "tenant.run.ai"},
+		{name: "backend FQDN", backendFQDN: "runai.example.com", want: "runai.example.com"},
+		{name: "neither", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv(env.RunAISaasEnvVar, test.saasAddress)
+			t.Setenv(env.BackendFQDNEnvVar, test.backendFQDN)
+
+			got, err := publicHostname()
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
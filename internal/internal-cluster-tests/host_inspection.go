@@ -0,0 +1,346 @@
+package internal_cluster_tests
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/run-ai/preinstall-diagnostics/internal/env"
+	"github.com/run-ai/preinstall-diagnostics/internal/resources"
+)
+
+const (
+	cgroup2SuperMagic = 0x63677270
+
+	minInotifyWatches   = 524288
+	minInotifyInstances = 8192
+	minNofile           = 65536
+	// Share of the system-wide file handles in use above which new processes
+	// may fail to open files
+	maxFileHandlesUsage = 0.8
+	minRuntimeFreeBytes = 20 * 1024 * 1024 * 1024
+)
+
+// hostRoot is where the host directories are found, a directory of fixtures
+// in tests
+var hostRoot = resources.HostInspectionRoot
+
+// HostInspectionEnabled tells whether the host directories are mounted into
+// the agent.
+func HostInspectionEnabled() bool {
+	return env.EnvOrDefault(env.HostInspectionEnvVar, "") == "true"
+}
+
+// HostCheck is the outcome of the inspection of a host setting.
+type HostCheck struct {
+	Name    string
+	Message string
+	Warning bool
+	Failed  bool
+	// Not applicable to the node, e.g. GPU checks on CPU nodes
+	Skipped bool
+}
+
+// InspectHost reports the host settings Run:ai installations depend on,
+// from the host directories mounted under resources.HostInspectionRoot. The
+// network sysctls are only reported by the host network agent, the only one
+// sharing the network namespace of the node.
+func InspectHost() []HostCheck {
+	if resources.NetworkFromEnv() == resources.NetworkHost {
+		return []HostCheck{ipForward(), bridgeNetfilter()}
+	}
+
+	checks := []HostCheck{
+		osRelease(),
+		kernelVersion(),
+		cgroupVersion(),
+		swap(),
+		inotifyLimits(),
+		podNetworkSkipped("IP Forwarding"),
+		podNetworkSkipped("Bridge Netfilter"),
+		kernelModules(),
+		runtimeDiskSpace(),
+		fileDescriptorLimits(),
+	}
+
+	return append(checks, inspectNVIDIA()...)
+}
+
+func osRelease() HostCheck {
+	check := HostCheck{Name: "OS Release"}
+
+	content, err := os.ReadFile(hostPath("/etc/os-release"))
+	if err != nil {
+		check.Failed, check.Message = true, err.Error()
+		return check
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		prettyName, found := strings.CutPrefix(line, "PRETTY_NAME=")
+		if found {
+			check.Message = strings.Trim(prettyName, `"`)
+			return check
+		}
+	}
+
+	check.Warning, check.Message = true, "PRETTY_NAME not found in /etc/os-release"
+	return check
+}
+
+func kernelVersion() HostCheck {
+	check := HostCheck{Name: "Kernel Version"}
+
+	version, err := readHostValue("/proc/sys/kernel/osrelease")
+	if err != nil {
+		check.Failed, check.Message = true, err.Error()
+		return check
+	}
+
+	check.Message = version
+	return check
+}
+
+func cgroupVersion() HostCheck {
+	check := HostCheck{Name: "Cgroup Version"}
+
+	stat := syscall.Statfs_t{}
+	err := syscall.Statfs(hostPath("/sys/fs/cgroup"), &stat)
+	if err != nil {
+		check.Failed, check.Message = true, err.Error()
+		return check
+	}
+
+	if int64(stat.Type) == cgroup2SuperMagic {
+		check.Message = "v2"
+	} else {
+		check.Message = "v1"
+	}
+
+	return check
+}
+
+func swap() HostCheck {
+	check := HostCheck{Name: "Swap"}
+
+	content, err := os.ReadFile(hostPath("/proc/swaps"))
+	if err != nil {
+		check.Failed, check.Message = true, err.Error()
+		return check
+	}
+
+	// the first line is a header
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) > 1 {
+		check.Warning = true
+		check.Message = "swap is enabled, kubelet refuses to start with swap unless configured otherwise:\n" +
+			strings.Join(lines[1:], "\n")
+		return check
+	}
+
+	check.Message = "disabled"
+	return check
+}
+
+func inotifyLimits() HostCheck {
+	check := HostCheck{Name: "Inotify Limits"}
+
+	watches, err := readHostInt("/proc/sys/fs/inotify/max_user_watches")
+	if err != nil {
+		check.Failed, check.Message = true, err.Error()
+		return check
+	}
+
+	instances, err := readHostInt("/proc/sys/fs/inotify/max_user_instances")
+	if err != nil {
+		check.Failed, check.Message = true, err.Error()
+		return check
+	}
+
+	check.Message = fmt.Sprintf("fs.inotify.max_user_watches = %d\nfs.inotify.max_user_instances = %d",
+		watches, instances)
+	if watches < minInotifyWatches || instances < minInotifyInstances {
+		check.Warning = true
+		check.Message += fmt.Sprintf("\nwarning: below the recommended %d watches and %d instances, "+
+			"pods may fail with \"too many open files\"", minInotifyWatches, minInotifyInstances)
+	}
+
+	return check
+}
+
+// podNetworkSkipped stands for the network sysctls in the pod network agent,
+// as they are read in the agent's own network namespace.
+func podNetworkSkipped(name string) HostCheck {
+	return HostCheck{
+		Name:    name,
+		Message: "the pod network namespace does not reflect the node, checked with --host-network",
+		Skipped: true,
+	}
+}
+
+// ipForward is read in the network namespace of the host network agent, from
+// its own /proc rather than the host's.
+func ipForward() HostCheck {
+	check := HostCheck{Name: "IP Forwarding"}
+
+	forward, err := readInt("/proc/sys/net/ipv4/ip_forward")
+	if err != nil {
+		check.Failed, check.Message = true, err.Error()
+		return check
+	}
+
+	check.Message = fmt.Sprintf("net.ipv4.ip_forward = %d", forward)
+	if forward != 1 {
+		check.Failed = true
+	}
+
+	return check
+}
+
+func bridgeNetfilter() HostCheck {
+	check := HostCheck{Name: "Bridge Netfilter"}
+
+	value, err := readInt("/proc/sys/net/bridge/bridge-nf-call-iptables")
+	if err != nil {
+		check.Warning = true
+		check.Message = "net.bridge.bridge-nf-call-iptables is not available, is the br_netfilter module loaded?"
+		return check
+	}
+
+	check.Message = fmt.Sprintf("net.bridge.bridge-nf-call-iptables = %d", value)
+	if value != 1 {
+		check.Warning = true
+	}
+
+	return check
+}
+
+func kernelModules() HostCheck {
+	check := HostCheck{Name: "Kernel Modules"}
+
+	lines := []string{}
+	missing := []string{}
+	for _, module := range []string{"overlay", "br_netfilter", "nvidia"} {
+		// built-in modules are listed in /sys/module too, unlike /proc/modules
+		_, err := os.Stat(hostPath("/sys/module/" + module))
+		if err != nil {
+			lines = append(lines, module+": not loaded")
+			if module != "nvidia" {
+				missing = append(missing, module)
+			}
+			continue
+		}
+		lines = append(lines, module+": loaded")
+	}
+
+	check.Message = strings.Join(lines, "\n")
+	if len(missing) > 0 {
+		check.Warning = true
+	}
+
+	return check
+}
+
+func runtimeDiskSpace() HostCheck {
+	check := HostCheck{Name: "Container Runtime Disk Space"}
+
+	// only the root of the runtime of the node is mounted
+	for _, root := range []string{
+		"/var/lib/containerd",
+		"/var/lib/containers",
+		"/var/lib/docker",
+		"/var/lib/rancher/k3s/agent/containerd",
+		"/var/lib/rancher/rke2/agent/containerd",
+	} {
+		stat := syscall.Statfs_t{}
+		err := syscall.Statfs(hostPath(root), &stat)
+		if err != nil {
+			continue
+		}
+
+		free := stat.Bavail * uint64(stat.Bsize)
+		total := stat.Blocks * uint64(stat.Bsize)
+		check.Message = fmt.Sprintf("%s: %d GiB free of %d GiB", root, free>>30, total>>30)
+		if free < minRuntimeFreeBytes {
+			check.Warning = true
+			check.Message += fmt.Sprintf("\nwarning: less than %d GiB free, image pulls may fail",
+				minRuntimeFreeBytes>>30)
+		}
+		return check
+	}
+
+	check.Warning = true
+	check.Message = "no containerd, CRI-O or docker root directory found"
+	return check
+}
+
+func fileDescriptorLimits() HostCheck {
+	check := HostCheck{Name: "File Descriptor Limits"}
+
+	fileMax, err := readHostInt("/proc/sys/fs/file-max")
+	if err != nil {
+		check.Failed, check.Message = true, err.Error()
+		return check
+	}
+
+	// allocated, unused and maximum file handles
+	fileNr, err := readHostValue("/proc/sys/fs/file-nr")
+	if err != nil {
+		check.Failed, check.Message = true, err.Error()
+		return check
+	}
+	allocated, _ := strconv.Atoi(strings.Fields(fileNr + " 0")[0])
+
+	rlimit := syscall.Rlimit{}
+	err = syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlimit)
+	if err != nil {
+		check.Failed, check.Message = true, err.Error()
+		return check
+	}
+
+	check.Message = fmt.Sprintf("fs.file-max = %d, %d allocated\ncontainer nofile limit = %d",
+		fileMax, allocated, rlimit.Cur)
+
+	if float64(allocated) > float64(fileMax)*maxFileHandlesUsage {
+		check.Warning = true
+		check.Message += "\nwarning: most of the system-wide file handles are in use"
+	}
+	if rlimit.Cur < minNofile {
+		check.Warning = true
+		check.Message += fmt.Sprintf("\nwarning: containers may open less than %d files", minNofile)
+	}
+
+	return check
+}
+
+func hostPath(p string) string {
+	return path.Join(hostRoot, p)
+}
+
+func readHostValue(p string) (string, error) {
+	return readValue(hostPath(p))
+}
+
+func readHostInt(p string) (int, error) {
+	return readInt(hostPath(p))
+}
+
+func readValue(p string) (string, error) {
+	content, err := os.ReadFile(p)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(content)), nil
+}
+
+func readInt(p string) (int, error) {
+	value, err := readValue(p)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(value)
+}
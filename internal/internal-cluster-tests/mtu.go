@@ -0,0 +1,101 @@
+package internal_cluster_tests
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/run-ai/preinstall-diagnostics/internal/env"
+	"github.com/run-ai/preinstall-diagnostics/internal/mesh"
+	"github.com/run-ai/preinstall-diagnostics/internal/probe"
+	"github.com/run-ai/preinstall-diagnostics/internal/resources"
+)
+
+const (
+	// Spans hundreds of packets, well above any MTU
+	largeTransferSize = 1024 * 1024
+
+	mtuProbeTimeout = 500 * time.Millisecond
+)
+
+// startUDPEchoServer answers the path MTU probes of the other agents, on the
+// same port number as the ping server.
+func startUDPEchoServer() {
+	conn, err := net.ListenPacket("udp", fmt.Sprintf(":%d", resources.NetworkFromEnv().AgentPort()))
+	if err != nil {
+		panic(err)
+	}
+
+	go func() {
+		_ = probe.ServeUDPEcho(conn)
+	}()
+}
+
+// measureMTU compares the path MTU to the peer with the MTU of the local
+// interface, and checks that transfers larger than the MTU complete.
+func measureMTU(ctx context.Context, client *http.Client, address string, peer mesh.PeerResult,
+	localMTU int) mesh.PeerResult {
+	url := fmt.Sprintf("%s//%s/%s", "http:", address, "ping")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(make([]byte, largeTransferSize)))
+	if err != nil {
+		peer.LargeTransferError = err.Error()
+		return peer
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	res, err := client.Do(req)
+	if err != nil {
+		peer.LargeTransferError = err.Error()
+	} else {
+		_ = res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			peer.LargeTransferError = fmt.Sprintf("got status code %d", res.StatusCode)
+		}
+	}
+
+	peer.InterfaceMTU = localMTU
+	if peer.InterfaceMTU == 0 {
+		return peer
+	}
+
+	// the peer's UDP echo server listens on the same port as its ping server
+	pathMTU, err := probe.PathMTU(ctx, address, peer.InterfaceMTU, mtuProbeTimeout)
+	if err == nil {
+		peer.PathMTU = pathMTU
+	}
+
+	return peer
+}
+
+// interfaceMTU returns the MTU of the interface holding the pod IP, 0 when it
+// cannot be found.
+func interfaceMTU() int {
+	podIP := net.ParseIP(env.EnvOrDefault(env.PodIPEnvVar, ""))
+	if podIP == nil {
+		return 0
+	}
+
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return 0
+	}
+
+	for _, iface := range interfaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if ok && ipNet.IP.Equal(podIP) {
+				return iface.MTU
+			}
+		}
+	}
+
+	return 0
+}
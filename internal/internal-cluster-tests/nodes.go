@@ -3,34 +3,35 @@ package internal_cluster_tests
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os/exec"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/run-ai/preinstall-diagnostics/internal/env"
 	"github.com/run-ai/preinstall-diagnostics/internal/k8sclient"
 	"github.com/run-ai/preinstall-diagnostics/internal/log"
+	"github.com/run-ai/preinstall-diagnostics/internal/mesh"
 	"github.com/run-ai/preinstall-diagnostics/internal/resources"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
 )
 
 const (
-	// Maximum amount of times to test for availability
-	attempts = 100
-
 	// Interval to wait between availability checks
 	sleepInterval = 5 * time.Second
 
-	nvidiaDevicePluginDaemonset = "nvidia-device-plugin"
-	dcgmExporterDaemonset       = "dcgm-exporter"
-
-	maximumAllowedTimeDiff = time.Minute
+	// Pings sent to a reachable peer to measure its latency and clock offset
+	pingSamples = 10
+	pingTimeout = 5 * time.Second
 )
 
 func ShowOSInfo() (string, error) {
@@ -48,27 +49,36 @@ func ShowOSInfo() (string, error) {
 	return strings.Join(strings.Split(string(output), " "), "\n"), nil
 }
 
-func CheckNodeConnectivity(logger *log.Logger) error {
+// CheckNodeConnectivity returns the connectivity of this node to the agent of
+// every node, and an error summarizing the broken pairs. The peers are
+// measured even when not every agent got ready, for the broken pairs to show.
+func CheckNodeConnectivity(logger *log.Logger) ([]mesh.PeerResult, error) {
 
 	startPingPongServer()
 
-	err := WaitForJobPodsToBeRunning(logger)
-	if err != nil {
-		return err
+	waitErr := WaitForJobPodsToBeRunning(logger)
+	if waitErr != nil {
+		logger.ErrorF("%v, measuring the agents running so far", waitErr)
 	}
 
-	err = waitAllPodsPingable(logger)
-	if err != nil {
-		return err
+	peers, err := measurePeers(logger)
+	if waitErr != nil {
+		return peers, errors.Join(waitErr, err)
 	}
 
-	return nil
+	return peers, err
 }
 
 func startPingPongServer() {
 	http.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
-		t := time.Now()
-		tjs, err := json.Marshal(t)
+		// large transfers are checked by posting a payload
+		_, _ = io.Copy(io.Discard, r.Body)
+
+		received := time.Now()
+		tjs, err := json.Marshal(mesh.PingResponse{
+			Received: received,
+			Sent:     time.Now(),
+		})
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			_, _ = w.Write([]byte(err.Error()))
@@ -79,11 +89,13 @@ func startPingPongServer() {
 	})
 
 	go func() {
-		err := http.ListenAndServe(":8080", nil)
+		err := http.ListenAndServe(fmt.Sprintf(":%d", resources.NetworkFromEnv().AgentPort()), nil)
 		if err != nil {
 			panic(err)
 		}
 	}()
+
+	startUDPEchoServer()
 }
 
 func WaitForJobPodsToBeRunning(logger *log.Logger) error {
@@ -99,12 +111,13 @@ func WaitForJobPodsToBeRunning(logger *log.Logger) error {
 
 	nodeCount := len(nodeList.Items)
 
-	podAvailabilityAttempts := attempts
-
-	for podAvailabilityAttempts > 0 {
+	for start := time.Now(); time.Since(start) < resources.AgentsStartTimeout; {
 		logger.LogF("waiting for jobs to be available...")
 
-		jobs, err := k8s.BatchV1().Jobs("runai-diagnostics").List(context.TODO(), metav1.ListOptions{})
+		names := resources.NamesFromEnv()
+		jobs, err := k8s.BatchV1().Jobs(names.Namespace).List(context.TODO(), metav1.ListOptions{
+			LabelSelector: names.AgentSelector(resources.NetworkFromEnv()),
+		})
 		if err != nil {
 			return err
 		}
@@ -122,7 +135,6 @@ func WaitForJobPodsToBeRunning(logger *log.Logger) error {
 			return nil
 		}
 
-		podAvailabilityAttempts--
 		time.Sleep(sleepInterval)
 	}
 
@@ -130,11 +142,9 @@ func WaitForJobPodsToBeRunning(logger *log.Logger) error {
 }
 
 func GetJobsPods(client *kubernetes.Clientset) ([]v1.Pod, error) {
-	labelSelector := strings.ReplaceAll(labels.FormatLabels(map[string]string{
-		"runai-diagnostics": "",
-	}), "=", "")
-	pods, err := client.CoreV1().Pods(resources.Namespace.Name).List(context.TODO(), metav1.ListOptions{
-		LabelSelector: labelSelector,
+	names := resources.NamesFromEnv()
+	pods, err := client.CoreV1().Pods(names.Namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: names.AgentSelector(resources.NetworkFromEnv()),
 	})
 	if err != nil {
 		return nil, err
@@ -143,103 +153,271 @@ func GetJobsPods(client *kubernetes.Clientset) ([]v1.Pod, error) {
 	return pods.Items, nil
 }
 
-func waitAllPodsPingable(logger *log.Logger) error {
+// measurePeers pings the agent of every node until it answers, then samples
+// the round trip time and the clock offset of the peer.
+func measurePeers(logger *log.Logger) ([]mesh.PeerResult, error) {
 	k8s, err := k8sclient.ClientSet()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	nodeName, err := env.EnvOrError(env.NodeNameEnvVar)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	podName, err := env.EnvOrError(env.PodNameEnvVar)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	pingedPods := map[string]struct{}{}
-	podPingAttempts := attempts
-	pingable := false
+	// pod IPs are pinged directly, whatever the proxy configuration
+	client := &http.Client{
+		Timeout:   pingTimeout,
+		Transport: &http.Transport{Proxy: nil},
+	}
 
-	pods, err := GetJobsPods(k8s)
+	peers := map[string]mesh.PeerResult{}
+
+	pods, err := meshPods(k8s)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	for podPingAttempts > 0 && !pingable {
+	localMTU := interfaceMTU()
+
+	// unreachable peers are retried within the time the CLI waits for the
+	// measurement of the peers
+	ctx, cancel := context.WithTimeout(context.Background(), resources.MeshTimeout(len(pods)))
+	defer cancel()
+
+	for ctx.Err() == nil {
+		pending := []v1.Pod{}
 		for _, pod := range pods {
-			_, pinged := pingedPods[pod.Name]
-			if pinged {
-				continue
+			if !peers[pod.Spec.NodeName].Reachable {
+				pending = append(pending, pod)
 			}
+		}
 
-			logger.LogF("attempting to ping pod [%s/%s]...", pod.Spec.NodeName, pod.Name)
-
-			ip := pod.Status.PodIP
-			url := fmt.Sprintf("%s//%s:%s/%s", "http:", ip, "8080", "ping")
-
-			res, err := http.Get(url)
-			if err != nil {
-				logger.ErrorF("[%s/%s] -> [%s/%s]: could not ping [%s/%s] due to %v, retrying in %d seconds",
-					nodeName, podName, pod.Spec.NodeName, pod.Name,
-					pod.Spec.NodeName, pod.Name, err, sleepInterval/time.Second)
-			} else {
-				if res.StatusCode != 200 {
-					logger.ErrorF("[%s/%s] -> [%s/%s]: http ping failed got status code %d",
-						nodeName, podName, pod.Spec.NodeName, pod.Name, res.StatusCode)
-				} else {
-					logger.LogF("[%s/%s] -> [%s/%s]: successfully pinged",
-						nodeName, podName, pod.Spec.NodeName, pod.Name)
-
-					targetTimeJSON, err := io.ReadAll(res.Body)
-					if err != nil {
-						return fmt.Errorf("[%s/%s] -> [%s/%s]: could not read pod ping response body: %v",
-							nodeName, podName, pod.Spec.NodeName, pod.Name, err)
-					}
-
-					myTime := time.Now()
-					targetTime := time.Time{}
-					err = json.Unmarshal(targetTimeJSON, &targetTime)
-					if err != nil {
-						return fmt.Errorf("[%s/%s] -> [%s/%s]: could not parse target pod time: %v",
-							nodeName, podName, pod.Spec.NodeName, pod.Name, err)
-					}
-
-					var diff time.Duration
-					if targetTime.After(myTime) {
-						diff = targetTime.Sub(myTime)
-					} else {
-						diff = myTime.Sub(targetTime)
-					}
-
-					if diff > maximumAllowedTimeDiff {
-						logger.ErrorF("[%s/%s] -> [%s/%s]: node clocks are out of sync",
-							nodeName, podName, pod.Spec.NodeName, pod.Name)
-					} else {
-						logger.LogF("[%s/%s] -> [%s/%s]: node clocks are in sync",
-							nodeName, podName, pod.Spec.NodeName, pod.Name)
-						pingedPods[pod.Name] = struct{}{}
-					}
-				}
-			}
+		// peers are measured concurrently, the path MTU probes of an
+		// unreachable size take seconds
+		measured := make([]mesh.PeerResult, len(pending))
+		wg := sync.WaitGroup{}
+		slots := make(chan struct{}, resources.MeshConcurrency)
+		for i, pod := range pending {
+			wg.Add(1)
+			slots <- struct{}{}
+			go func(i int, pod v1.Pod) {
+				defer func() {
+					<-slots
+					wg.Done()
+				}()
+
+				measured[i] = measurePeer(ctx, logger, client, nodeName, podName, pod, localMTU)
+			}(i, pod)
+		}
+		wg.Wait()
+
+		for _, peer := range measured {
+			peers[peer.Node] = peer
 		}
 
-		podPingAttempts--
-		pingable = len(pingedPods) == len(pods)
+		if allReachable(peers, pods) {
+			break
+		}
 
-		time.Sleep(sleepInterval)
+		select {
+		case <-ctx.Done():
+		case <-time.After(sleepInterval):
+		}
 
-		pods, err = GetJobsPods(k8s)
+		pods, err = meshPods(k8s)
 		if err != nil {
-			return err
+			return nil, err
+		}
+	}
+
+	results := []mesh.PeerResult{}
+	for _, peer := range peers {
+		results = append(results, peer)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Node < results[j].Node
+	})
+
+	unreachable := []string{}
+	skewed := []string{}
+	largeTransfersFail := []string{}
+	for _, peer := range results {
+		if !peer.Reachable {
+			unreachable = append(unreachable, peer.Node)
+			continue
+		}
+		if peer.ClockSkewFailed {
+			skewed = append(skewed, peer.Node)
+		}
+		if peer.LargeTransferError != "" {
+			largeTransfersFail = append(largeTransfersFail, peer.Node)
+		}
+	}
+
+	if len(unreachable) > 0 || len(skewed) > 0 || len(largeTransfersFail) > 0 {
+		problems := []string{}
+		if len(unreachable) > 0 {
+			problems = append(problems, fmt.Sprintf("failed to ping the pods of nodes %s",
+				strings.Join(unreachable, ", ")))
+		}
+		if len(skewed) > 0 {
+			problems = append(problems, fmt.Sprintf("clocks of nodes %s are out of sync",
+				strings.Join(skewed, ", ")))
+		}
+		if len(largeTransfersFail) > 0 {
+			problems = append(problems, fmt.Sprintf("large transfers to nodes %s fail, check the MTU of the network",
+				strings.Join(largeTransfersFail, ", ")))
+		}
+		return results, fmt.Errorf("%s", strings.Join(problems, "\n"))
+	}
+
+	return results, nil
+}
+
+// measurePeer pings the agent of the pod, and samples it once it answers,
+// within resources.PeerMeasurementTimeout.
+func measurePeer(ctx context.Context, logger *log.Logger, client *http.Client, nodeName, podName string,
+	pod v1.Pod, localMTU int) mesh.PeerResult {
+	ctx, cancel := context.WithTimeout(ctx, resources.PeerMeasurementTimeout)
+	defer cancel()
+
+	logger.LogF("attempting to ping pod [%s/%s]...", pod.Spec.NodeName, pod.Name)
+
+	peer := mesh.PeerResult{
+		Node: pod.Spec.NodeName,
+		Pod:  pod.Name,
+	}
+
+	_, _, err := ping(ctx, client, agentAddress(pod))
+	if err != nil {
+		logger.ErrorF("[%s/%s] -> [%s/%s]: could not ping [%s/%s] due to %v, retrying in %d seconds",
+			nodeName, podName, pod.Spec.NodeName, pod.Name,
+			pod.Spec.NodeName, pod.Name, err, sleepInterval/time.Second)
+		peer.Error = err.Error()
+		return peer
+	}
+
+	logger.LogF("[%s/%s] -> [%s/%s]: successfully pinged",
+		nodeName, podName, pod.Spec.NodeName, pod.Name)
+
+	return samplePeer(ctx, client, agentAddress(pod), peer, localMTU)
+}
+
+// samplePeer pings a reachable peer pingSamples times.
+func samplePeer(ctx context.Context, client *http.Client, address string, peer mesh.PeerResult,
+	localMTU int) mesh.PeerResult {
+	rtts := []time.Duration{}
+	offsets := []time.Duration{}
+	for i := 0; i < pingSamples; i++ {
+		rtt, offset, err := ping(ctx, client, address)
+		if err != nil {
+			peer.Error = err.Error()
+			continue
+		}
+
+		rtts = append(rtts, rtt)
+		offsets = append(offsets, offset)
+	}
+
+	if len(rtts) == 0 {
+		return peer
+	}
+
+	peer.Reachable = true
+	peer.Samples = len(rtts)
+	peer.RTTP50 = mesh.Percentile(rtts, 50)
+	peer.RTTP90 = mesh.Percentile(rtts, 90)
+	peer.RTTMax = mesh.Percentile(rtts, 100)
+	peer.ClockOffset = mesh.Percentile(offsets, 50)
+
+	peer.ClockSkewWarning, peer.ClockSkewFailed = mesh.ClockSkewThresholdsFromEnv().Check(peer.ClockOffset)
+
+	return measureMTU(ctx, client, address, peer, localMTU)
+}
+
+// ping returns the round trip time to the peer agent, excluding the time the
+// peer took to respond, and the offset of the peer's clock.
+func ping(ctx context.Context, client *http.Client, address string) (time.Duration, time.Duration, error) {
+	url := fmt.Sprintf("%s//%s/%s", "http:", address, "ping")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	requested := time.Now()
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer res.Body.Close()
+
+	pingResponseJSON, err := io.ReadAll(res.Body)
+	responded := time.Now()
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not read pod ping response body: %v", err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return 0, 0, fmt.Errorf("http ping failed got status code %d", res.StatusCode)
+	}
+
+	pingResponse := mesh.PingResponse{}
+	err = json.Unmarshal(pingResponseJSON, &pingResponse)
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not parse target pod time: %v", err)
+	}
+
+	offset, rtt := mesh.ClockOffset(requested, pingResponse, responded)
+	return rtt, offset, nil
+}
+
+// meshPods returns the pods of the peers this agent pings, every agent when
+// the mesh is not sampled.
+func meshPods(k8s *kubernetes.Clientset) ([]v1.Pod, error) {
+	pods, err := GetJobsPods(k8s)
+	if err != nil {
+		return nil, err
+	}
+
+	meshPeers, err := env.EnvOrError(env.MeshPeersEnvVar)
+	if err != nil {
+		return pods, nil
+	}
+
+	peers := map[string]struct{}{}
+	for _, peer := range strings.Split(meshPeers, ",") {
+		peers[peer] = struct{}{}
+	}
+
+	peerPods := []v1.Pod{}
+	for _, pod := range pods {
+		if _, found := peers[pod.Spec.NodeName]; found {
+			peerPods = append(peerPods, pod)
 		}
 	}
 
-	if !pingable {
-		return fmt.Errorf("failed to ping all pods")
+	return peerPods, nil
+}
+
+// agentAddress returns the address the agent of the pod serves, agents only
+// ping agents running on the same network.
+func agentAddress(pod v1.Pod) string {
+	return net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(int(resources.NetworkFromEnv().AgentPort())))
+}
+
+func allReachable(peers map[string]mesh.PeerResult, pods []v1.Pod) bool {
+	for _, pod := range pods {
+		if !peers[pod.Spec.NodeName].Reachable {
+			return false
+		}
 	}
 
-	return nil
+	return true
 }
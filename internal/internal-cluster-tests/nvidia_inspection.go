@@ -0,0 +1,331 @@
+package internal_cluster_tests
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	nvidiaPCIVendor         = "0x10de"
+	nvidiaDriverVersionPath = "/proc/driver/nvidia/version"
+	nvidiaToolkitConfigPath = "/etc/nvidia-container-runtime/config.toml"
+	// Where the GPU Operator installs the toolkit, outside of the mounted
+	// host directories
+	gpuOperatorToolkitDir = "/usr/local/nvidia/toolkit"
+)
+
+var (
+	// e.g. "NVRM version: NVIDIA UNIX x86_64 Kernel Module  535.129.03  Thu Oct 19 18:56:32 UTC 2023"
+	// or "NVRM version: NVIDIA UNIX Open Kernel Module for x86_64  535.129.03  Release Build ..."
+	nvidiaDriverVersionRegex = regexp.MustCompile(`Kernel Module(?: for \S+)?\s+(\d+\.\d+(?:\.\d+)?)`)
+	nvidiaGPUDeviceRegex     = regexp.MustCompile(`^nvidia\d+$`)
+
+	// Section of the nvidia runtime handler and its options, e.g.
+	// [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.nvidia.options]
+	// or [crio.runtime.runtimes.nvidia]
+	nvidiaRuntimeSectionRegex = regexp.MustCompile(`^\s*\[.*runtimes\.("nvidia"|nvidia)(\.options)?\]\s*$`)
+	tomlSectionRegex          = regexp.MustCompile(`^\s*\[.*\]\s*$`)
+
+	containerdConfigPatterns = []string{
+		"/etc/containerd/config.toml",
+		"/etc/containerd/conf.d/*.toml",
+		"/var/lib/rancher/k3s/agent/etc/containerd/config.toml",
+		"/var/lib/rancher/rke2/agent/etc/containerd/config.toml",
+	}
+	crioConfigPatterns = []string{
+		"/etc/crio/crio.conf",
+		"/etc/crio/crio.conf.d/*",
+	}
+)
+
+// runtimeHandler is the nvidia runtime handler found in the configuration of
+// the container runtime.
+type runtimeHandler struct {
+	configFiles []string
+	file        string
+	binary      string
+	isDefault   bool
+}
+
+// inspectNVIDIA reports the NVIDIA driver, device nodes, runtime handler and
+// container toolkit of the node, all skipped on nodes with neither NVIDIA GPUs
+// nor driver.
+func inspectNVIDIA() []HostCheck {
+	gpus := nvidiaPCIDevices()
+	_, driverErr := os.Stat(hostPath(nvidiaDriverVersionPath))
+
+	if len(gpus) == 0 && driverErr != nil {
+		checks := []HostCheck{}
+		for _, name := range []string{"NVIDIA Driver", "NVIDIA Devices", "NVIDIA Runtime Handler", "NVIDIA Container Toolkit"} {
+			checks = append(checks, HostCheck{
+				Name:    name,
+				Message: "no NVIDIA GPU on the node",
+				Skipped: true,
+			})
+		}
+		return checks
+	}
+
+	handler := findRuntimeHandler()
+
+	return []HostCheck{
+		nvidiaDriver(gpus),
+		nvidiaDevices(gpus),
+		nvidiaRuntimeHandler(handler),
+		nvidiaContainerToolkit(handler),
+	}
+}
+
+// nvidiaPCIDevices returns the PCI addresses of the NVIDIA display and 3D
+// controllers, leaving out NVSwitches and bridges.
+func nvidiaPCIDevices() []string {
+	devices, err := filepath.Glob(hostPath("/sys/bus/pci/devices/*"))
+	if err != nil {
+		return nil
+	}
+
+	gpus := []string{}
+	for _, device := range devices {
+		vendor, err := os.ReadFile(path.Join(device, "vendor"))
+		if err != nil || strings.TrimSpace(string(vendor)) != nvidiaPCIVendor {
+			continue
+		}
+
+		class, err := os.ReadFile(path.Join(device, "class"))
+		if err != nil || !strings.HasPrefix(strings.TrimSpace(string(class)), "0x03") {
+			continue
+		}
+
+		gpus = append(gpus, path.Base(device))
+	}
+
+	return gpus
+}
+
+func nvidiaDriver(gpus []string) HostCheck {
+	check := HostCheck{Name: "NVIDIA Driver"}
+
+	version, err := readHostValue(nvidiaDriverVersionPath)
+	if err != nil {
+		check.Failed = true
+		check.Message = fmt.Sprintf("%d NVIDIA GPUs found on the PCI bus but no NVIDIA driver is loaded: %v",
+			len(gpus), err)
+		return check
+	}
+
+	matches := nvidiaDriverVersionRegex.FindStringSubmatch(version)
+	if matches == nil {
+		check.Warning = true
+		check.Message = "could not parse the driver version:\n" + version
+		return check
+	}
+
+	check.Message = "driver " + matches[1]
+	if strings.Contains(version, "Open Kernel Module") {
+		check.Message += " (open kernel module)"
+	}
+	check.Message += fmt.Sprintf("\n%d NVIDIA GPUs on the PCI bus", len(gpus))
+
+	return check
+}
+
+func nvidiaDevices(gpus []string) HostCheck {
+	check := HostCheck{Name: "NVIDIA Devices"}
+
+	devices, err := filepath.Glob(hostPath("/dev/nvidia*"))
+	if err != nil {
+		check.Failed, check.Message = true, err.Error()
+		return check
+	}
+
+	names := []string{}
+	found := map[string]bool{}
+	gpuDevices := 0
+	for _, device := range devices {
+		name := path.Base(device)
+		names = append(names, name)
+		found[name] = true
+		if nvidiaGPUDeviceRegex.MatchString(name) {
+			gpuDevices++
+		}
+	}
+
+	if len(names) == 0 {
+		check.Failed, check.Message = true, "no /dev/nvidia* device nodes"
+		return check
+	}
+
+	check.Message = strings.Join(names, " ")
+
+	switch {
+	case !found["nvidiactl"]:
+		check.Failed = true
+		check.Message += "\n/dev/nvidiactl is missing"
+	case gpuDevices < len(gpus):
+		// e.g. GPUs bound to vfio-pci for passthrough to VMs
+		check.Warning = true
+		check.Message += fmt.Sprintf("\nwarning: %d GPU device nodes for %d NVIDIA GPUs on the PCI bus",
+			gpuDevices, len(gpus))
+	case !found["nvidia-uvm"]:
+		check.Warning = true
+		check.Message += "\nwarning: /dev/nvidia-uvm is missing, CUDA applications fail until the nvidia-uvm module is loaded"
+	}
+
+	return check
+}
+
+func nvidiaRuntimeHandler(handler runtimeHandler) HostCheck {
+	check := HostCheck{Name: "NVIDIA Runtime Handler"}
+
+	if len(handler.configFiles) == 0 {
+		check.Warning = true
+		check.Message = "no containerd or CRI-O configuration found"
+		return check
+	}
+
+	if handler.file == "" {
+		check.Failed = true
+		check.Message = "no nvidia runtime handler in " + strings.Join(handler.configFiles, ", ") +
+			", containers cannot access the GPUs"
+		return check
+	}
+
+	check.Message = "nvidia runtime handler in " + handler.file
+	if handler.binary != "" {
+		check.Message += "\nbinary " + handler.binary
+	}
+
+	if !handler.isDefault {
+		check.Warning = true
+		check.Message += "\nwarning: nvidia is not the default runtime, GPU pods need runtimeClassName: nvidia"
+	}
+
+	return check
+}
+
+func nvidiaContainerToolkit(handler runtimeHandler) HostCheck {
+	check := HostCheck{Name: "NVIDIA Container Toolkit"}
+
+	if strings.HasPrefix(handler.binary, gpuOperatorToolkitDir) {
+		check.Message = "installed by the GPU Operator in " + gpuOperatorToolkitDir
+		return check
+	}
+
+	config, err := os.ReadFile(hostPath(nvidiaToolkitConfigPath))
+	if err != nil {
+		check.Failed = true
+		check.Message = nvidiaToolkitConfigPath + " not found, is the nvidia-container-toolkit installed?"
+		return check
+	}
+
+	lines := []string{nvidiaToolkitConfigPath}
+	for _, key := range []string{"mode", "ldconfig", "no-cgroups"} {
+		value, found := tomlValue(string(config), key)
+		if !found {
+			continue
+		}
+		lines = append(lines, key+" = "+value)
+
+		if key == "no-cgroups" && value == "true" {
+			check.Warning = true
+			lines = append(lines, "warning: no-cgroups is meant for rootless containers, "+
+				"Kubernetes containers may not get access to the GPUs")
+		}
+	}
+
+	check.Message = strings.Join(lines, "\n")
+	return check
+}
+
+// findRuntimeHandler looks for the nvidia runtime handler in the containerd
+// and CRI-O configuration files of the host.
+func findRuntimeHandler() runtimeHandler {
+	handler := runtimeHandler{}
+
+	for _, runtime := range []struct {
+		patterns   []string
+		binaryKey  string
+		defaultKey string
+	}{
+		{containerdConfigPatterns, "BinaryName", "default_runtime_name"},
+		{crioConfigPatterns, "runtime_path", "default_runtime"},
+	} {
+		for _, pattern := range runtime.patterns {
+			files, _ := filepath.Glob(hostPath(pattern))
+			for _, file := range files {
+				content, err := os.ReadFile(file)
+				if err != nil {
+					continue
+				}
+
+				hostFile := strings.TrimPrefix(file, hostRoot)
+				handler.configFiles = append(handler.configFiles, hostFile)
+
+				section, found := nvidiaRuntimeSection(string(content))
+				if found && handler.file == "" {
+					handler.file = hostFile
+					handler.binary, _ = tomlValue(section, runtime.binaryKey)
+				}
+
+				defaultRuntime, found := tomlValue(string(content), runtime.defaultKey)
+				if found && defaultRuntime == "nvidia" {
+					handler.isDefault = true
+				}
+			}
+		}
+	}
+
+	return handler
+}
+
+// nvidiaRuntimeSection returns the lines of the nvidia runtime handler
+// section and its options, up to the next section.
+func nvidiaRuntimeSection(config string) (string, bool) {
+	section := []string{}
+	found, inSection := false, false
+
+	scanner := bufio.NewScanner(strings.NewReader(config))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if tomlSectionRegex.MatchString(line) {
+			inSection = nvidiaRuntimeSectionRegex.MatchString(line)
+			if found && !inSection {
+				break
+			}
+			found = found || inSection
+			continue
+		}
+
+		if inSection {
+			section = append(section, line)
+		}
+	}
+
+	return strings.Join(section, "\n"), found
+}
+
+// tomlValue returns the value of the first uncommented key = value line for
+// the key, without quotes. It is enough for the flat settings checked here.
+func tomlValue(config, key string) (string, bool) {
+	scanner := bufio.NewScanner(strings.NewReader(config))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, value, found := strings.Cut(line, "=")
+		if !found || strings.TrimSpace(name) != key {
+			continue
+		}
+
+		return strings.Trim(strings.TrimSpace(value), `"'`), true
+	}
+
+	return "", false
+}
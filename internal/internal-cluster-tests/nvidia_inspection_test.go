@@ -0,0 +1,225 @@
+package internal_cluster_tests
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func setHostRoot(t *testing.T, root string) {
+	previous := hostRoot
+	hostRoot = root
+	t.Cleanup(func() { hostRoot = previous })
+}
+
+func writeHostFile(t *testing.T, root, p, content string) {
+	t.Helper()
+
+	err := os.MkdirAll(path.Dir(path.Join(root, p)), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(path.Join(root, p), []byte(content), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInspectNVIDIASkipped(t *testing.T) {
+	setHostRoot(t, t.TempDir())
+
+	// an Intel GPU and an NVIDIA bridge, neither of them an NVIDIA GPU
+	writeHostFile(t, hostRoot, "/sys/bus/pci/devices/0000:00:02.0/vendor", "0x8086\n")
+	writeHostFile(t, hostRoot, "/sys/bus/pci/devices/0000:00:02.0/class", "0x030000\n")
+	writeHostFile(t, hostRoot, "/sys/bus/pci/devices/0000:05:00.0/vendor", "0x10de\n")
+	writeHostFile(t, hostRoot, "/sys/bus/pci/devices/0000:05:00.0/class", "0x068000\n")
+
+	checks := inspectNVIDIA()
+	if len(checks) != 4 {
+		t.Fatalf("got %d checks, want 4", len(checks))
+	}
+	for _, check := range checks {
+		if !check.Skipped || check.Failed {
+			t.Errorf("%s: got %+v, want skipped", check.Name, check)
+		}
+	}
+}
+
+func TestInspectNVIDIAWithoutDriver(t *testing.T) {
+	setHostRoot(t, t.TempDir())
+
+	writeHostFile(t, hostRoot, "/sys/bus/pci/devices/0000:3b:00.0/vendor", "0x10de\n")
+	writeHostFile(t, hostRoot, "/sys/bus/pci/devices/0000:3b:00.0/class", "0x030200\n")
+	writeHostFile(t, hostRoot, "/etc/containerd/config.toml", `version = 2
+[plugins."io.containerd.grpc.v1.cri".containerd.runtimes.nvidia.options]
+  BinaryName = "/usr/bin/nvidia-container-runtime"
+`)
+
+	checks := inspectNVIDIA()
+	if len(checks) != 4 {
+		t.Fatalf("got %d checks, want 4", len(checks))
+	}
+	if driver := checks[0]; driver.Skipped || !driver.Failed {
+		t.Errorf("%s: got %+v, want failed", driver.Name, driver)
+	}
+	if handler := checks[2]; handler.Message != "nvidia runtime handler in /etc/containerd/config.toml\n"+
+		"binary /usr/bin/nvidia-container-runtime\n"+
+		"warning: nvidia is not the default runtime, GPU pods need runtimeClassName: nvidia" {
+		t.Errorf("%s: got %q", handler.Name, handler.Message)
+	}
+}
+
+func TestNVIDIADriverVersionRegex(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		want    string
+	}{
+		{
+			name: "proprietary",
+			version: "NVRM version: NVIDIA UNIX x86_64 Kernel Module  535.129.03  Thu Oct 19 18:56:32 UTC 2023\n" +
+				"GCC version:  gcc version 11.4.0 (Ubuntu 11.4.0-1ubuntu1~22.04)",
+			want: "535.129.03",
+		},
+		{
+			name: "open kernel module",
+			version: "NVRM version: NVIDIA UNIX Open Kernel Module for x86_64  550.54.15  Release Build  " +
+				"(dvs-builder@U16-I3-B03-4-3)  Tue Mar  5 22:15:33 UTC 2024",
+			want: "550.54.15",
+		},
+		{
+			name:    "aarch64",
+			version: "NVRM version: NVIDIA UNIX aarch64 Kernel Module  470.223.02  Sat Oct  7 15:35:28 UTC 2023",
+			want:    "470.223.02",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			matches := nvidiaDriverVersionRegex.FindStringSubmatch(test.version)
+			if matches == nil {
+				t.Fatalf("no match in %q", test.version)
+			}
+			if matches[1] != test.want {
+				t.Errorf("got %q, want %q", matches[1], test.want)
+			}
+		})
+	}
+}
+
+func TestNVIDIARuntimeSection(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      string
+		binaryKey   string
+		defaultKey  string
+		wantFound   bool
+		wantBinary  string
+		wantDefault string
+	}{
+		{
+			name: "containerd v2",
+			config: `version = 2
+[plugins."io.containerd.grpc.v1.cri".containerd]
+  default_runtime_name = "nvidia"
+
+  [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.nvidia]
+    privileged_without_host_devices = false
+    runtime_type = "io.containerd.runc.v2"
+
+    [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.nvidia.options]
+      BinaryName = "/usr/local/nvidia/toolkit/nvidia-container-runtime"
+
+  [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.runc]
+    runtime_type = "io.containerd.runc.v2"
+
+    [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.runc.options]
+      BinaryName = "/usr/bin/runc"
+`,
+			binaryKey:   "BinaryName",
+			defaultKey:  "default_runtime_name",
+			wantFound:   true,
+			wantBinary:  "/usr/local/nvidia/toolkit/nvidia-container-runtime",
+			wantDefault: "nvidia",
+		},
+		{
+			name: "containerd v3",
+			config: `version = 3
+[plugins."io.containerd.cri.v1.runtime".containerd]
+  default_runtime_name = "runc"
+
+  [plugins."io.containerd.cri.v1.runtime".containerd.runtimes.runc]
+    runtime_type = "io.containerd.runc.v2"
+
+    [plugins."io.containerd.cri.v1.runtime".containerd.runtimes.runc.options]
+      BinaryName = "/usr/bin/runc"
+
+  [plugins."io.containerd.cri.v1.runtime".containerd.runtimes."nvidia"]
+    runtime_type = "io.containerd.runc.v2"
+
+    [plugins."io.containerd.cri.v1.runtime".containerd.runtimes."nvidia".options]
+      # BinaryName = "/usr/local/bin/nvidia-container-runtime"
+      BinaryName = "/usr/bin/nvidia-container-runtime"
+`,
+			binaryKey:   "BinaryName",
+			defaultKey:  "default_runtime_name",
+			wantFound:   true,
+			wantBinary:  "/usr/bin/nvidia-container-runtime",
+			wantDefault: "runc",
+		},
+		{
+			name: "CRI-O",
+			config: `[crio.runtime]
+default_runtime = "nvidia"
+
+[crio.runtime.runtimes.runc]
+runtime_path = "/usr/bin/runc"
+
+[crio.runtime.runtimes.nvidia]
+runtime_path = "/usr/bin/nvidia-container-runtime"
+runtime_type = "oci"
+
+[crio.image]
+pause_image = "registry.k8s.io/pause:3.9"
+`,
+			binaryKey:   "runtime_path",
+			defaultKey:  "default_runtime",
+			wantFound:   true,
+			wantBinary:  "/usr/bin/nvidia-container-runtime",
+			wantDefault: "nvidia",
+		},
+		{
+			name: "no nvidia runtime",
+			config: `version = 2
+[plugins."io.containerd.grpc.v1.cri".containerd]
+  default_runtime_name = "runc"
+
+  [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.runc.options]
+    BinaryName = "/usr/bin/runc"
+`,
+			binaryKey:   "BinaryName",
+			defaultKey:  "default_runtime_name",
+			wantDefault: "runc",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			section, found := nvidiaRuntimeSection(test.config)
+			if found != test.wantFound {
+				t.Fatalf("got found %t, want %t", found, test.wantFound)
+			}
+
+			binary, _ := tomlValue(section, test.binaryKey)
+			if binary != test.wantBinary {
+				t.Errorf("got binary %q, want %q", binary, test.wantBinary)
+			}
+
+			defaultRuntime, _ := tomlValue(test.config, test.defaultKey)
+			if defaultRuntime != test.wantDefault {
+				t.Errorf("got default runtime %q, want %q", defaultRuntime, test.wantDefault)
+			}
+		})
+	}
+}
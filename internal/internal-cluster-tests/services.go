@@ -0,0 +1,160 @@
+package internal_cluster_tests
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/run-ai/preinstall-diagnostics/internal/env"
+	"github.com/run-ai/preinstall-diagnostics/internal/k8sclient"
+	"github.com/run-ai/preinstall-diagnostics/internal/resources"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	defaultClusterDomain = "cluster.local"
+
+	// Endpoints of new Services take a while to be programmed on every node
+	serviceAttempts = 6
+	serviceInterval = 5 * time.Second
+)
+
+// ClusterDomain returns the DNS domain of the cluster, as found in the
+// <namespace>.svc.<domain> search domain kubelet configures for pods.
+func ClusterDomain() string {
+	content, err := os.ReadFile(resolvConfPath)
+	if err != nil {
+		return defaultClusterDomain
+	}
+
+	for _, domain := range ParseResolvConf(string(content)).Search {
+		if strings.HasPrefix(domain, "svc.") {
+			return strings.TrimSuffix(strings.TrimPrefix(domain, "svc."), ".")
+		}
+	}
+
+	return defaultClusterDomain
+}
+
+// KubernetesServiceResolvable resolves the kubernetes Service through the
+// cluster DNS.
+func KubernetesServiceResolvable() (string, error) {
+	host := "kubernetes.default.svc." + ClusterDomain()
+
+	addresses, err := lookupHostWithRetries(host)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s: %s", host, strings.Join(addresses, ", ")), nil
+}
+
+// HeadlessServiceResolvable resolves the headless Service of the diagnostics
+// agents, which should include the address of this agent.
+func HeadlessServiceResolvable() (string, error) {
+	names := resources.NamesFromEnv()
+	host := fmt.Sprintf("%s.%s.svc.%s", names.ForHeadlessService(), names.Namespace, ClusterDomain())
+
+	var addresses []string
+	var err error
+	podIP := env.EnvOrDefault(env.PodIPEnvVar, "")
+	for i := 0; i < serviceAttempts; i++ {
+		addresses, err = net.DefaultResolver.LookupHost(context.TODO(), host)
+		if err == nil && (podIP == "" || slices.Contains(addresses, podIP)) {
+			return fmt.Sprintf("%s: %d addresses", host, len(addresses)), nil
+		}
+
+		time.Sleep(serviceInterval)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return "", fmt.Errorf("%s resolved to %d addresses, none of which is this pod's address %s",
+		host, len(addresses), podIP)
+}
+
+// ServiceReachable pings the diagnostics agents through their ClusterIP
+// Service.
+func ServiceReachable() (string, error) {
+	names := resources.NamesFromEnv()
+	host := fmt.Sprintf("%s.%s.svc.%s", names.ForRun(), names.Namespace, ClusterDomain())
+
+	// the Service is reached directly, whatever the proxy configuration
+	client := &http.Client{
+		Timeout:   pingTimeout,
+		Transport: &http.Transport{Proxy: nil},
+	}
+
+	var err error
+	for i := 0; i < serviceAttempts; i++ {
+		var rtt time.Duration
+		rtt, _, err = ping(context.TODO(), client, net.JoinHostPort(host, strconv.Itoa(resources.AgentPort)))
+		if err == nil {
+			return fmt.Sprintf("%s:%d: rtt %s", host, resources.AgentPort, rtt), nil
+		}
+
+		time.Sleep(serviceInterval)
+	}
+
+	return "", err
+}
+
+// APIServerServiceReachable requests the API server through the service IP
+// of the kubernetes Service, rather than any address configured on the node.
+func APIServerServiceReachable() (string, error) {
+	host, err := env.EnvOrError(env.KubernetesServiceHostEnvVar)
+	if err != nil {
+		return "", err
+	}
+
+	port := env.EnvOrDefault(env.KubernetesServicePortEnvVar, "443")
+	address := net.JoinHostPort(host, port)
+
+	config, err := k8sclient.InClusterConfig()
+	if err != nil {
+		return "", err
+	}
+	config.Host = "https://" + address
+
+	client, err := rest.HTTPClientFor(config)
+	if err != nil {
+		return "", err
+	}
+	client.Timeout = pingTimeout
+
+	start := time.Now()
+	res, err := client.Get(config.Host + "/version")
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: got status code %d", address, res.StatusCode)
+	}
+
+	return fmt.Sprintf("%s: %s", address, time.Since(start).Round(time.Millisecond)), nil
+}
+
+func lookupHostWithRetries(host string) ([]string, error) {
+	var addresses []string
+	var err error
+	for i := 0; i < serviceAttempts; i++ {
+		addresses, err = net.DefaultResolver.LookupHost(context.TODO(), host)
+		if err == nil {
+			return addresses, nil
+		}
+
+		time.Sleep(serviceInterval)
+	}
+
+	return nil, err
+}
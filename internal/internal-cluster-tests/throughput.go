@@ -0,0 +1,146 @@
+package internal_cluster_tests
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/run-ai/preinstall-diagnostics/internal/env"
+	"github.com/run-ai/preinstall-diagnostics/internal/k8sclient"
+	"github.com/run-ai/preinstall-diagnostics/internal/log"
+	"github.com/run-ai/preinstall-diagnostics/internal/probe"
+	"github.com/run-ai/preinstall-diagnostics/internal/resources"
+)
+
+var (
+	throughputServedMu sync.Mutex
+	// Source nodes which completed their throughput test to this node
+	throughputServed = map[string]struct{}{}
+)
+
+// ThroughputMeasurement is the throughput from this node to a target node.
+type ThroughputMeasurement struct {
+	Node   string
+	Result probe.ThroughputResult
+	Err    error
+}
+
+// ThroughputEnabled tells whether the agent takes part in throughput tests.
+func ThroughputEnabled() bool {
+	_, err := env.EnvOrError(env.ThroughputDurationEnvVar)
+	return err == nil
+}
+
+// StartThroughputServer receives the throughput tests of the source nodes.
+func StartThroughputServer() error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", resources.ThroughputPort))
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		_ = probe.ServeThroughput(listener, func(source string) {
+			throughputServedMu.Lock()
+			defer throughputServedMu.Unlock()
+			throughputServed[source] = struct{}{}
+		})
+	}()
+
+	return nil
+}
+
+// MeasureThroughput sends data to every target node in turn and returns the
+// throughput measured by each target.
+func MeasureThroughput(logger *log.Logger) ([]ThroughputMeasurement, error) {
+	duration, err := time.ParseDuration(env.EnvOrDefault(env.ThroughputDurationEnvVar, ""))
+	if err != nil {
+		return nil, err
+	}
+
+	nodeName, err := env.EnvOrError(env.NodeNameEnvVar)
+	if err != nil {
+		return nil, err
+	}
+
+	k8s, err := k8sclient.ClientSet()
+	if err != nil {
+		return nil, err
+	}
+
+	pods, err := GetJobsPods(k8s)
+	if err != nil {
+		return nil, err
+	}
+
+	podIPs := map[string]string{}
+	for _, pod := range pods {
+		podIPs[pod.Spec.NodeName] = pod.Status.PodIP
+	}
+
+	measurements := []ThroughputMeasurement{}
+	for _, target := range nodeList(env.EnvOrDefault(env.ThroughputTargetsEnvVar, "")) {
+		measurement := ThroughputMeasurement{
+			Node: target,
+		}
+
+		podIP, found := podIPs[target]
+		if !found || podIP == "" {
+			measurement.Err = fmt.Errorf("no diagnostics agent is running on node %s", target)
+			measurements = append(measurements, measurement)
+			continue
+		}
+
+		logger.LogF("measuring throughput to node %s for %s...", target, duration)
+		measurement.Result, measurement.Err = probe.Throughput(
+			net.JoinHostPort(podIP, strconv.Itoa(resources.ThroughputPort)), nodeName, duration, probe.DefaultOptions())
+		measurements = append(measurements, measurement)
+	}
+
+	return measurements, nil
+}
+
+// WaitForThroughputSources keeps the agent, and its throughput server, running
+// until every source node has completed its test.
+func WaitForThroughputSources(logger *log.Logger) {
+	sources := nodeList(env.EnvOrDefault(env.ThroughputSourcesEnvVar, ""))
+
+	for timeout := resources.ThroughputSourcesTimeout; timeout > 0; timeout -= sleepInterval {
+		pending := pendingThroughputSources(sources)
+		if len(pending) == 0 {
+			return
+		}
+
+		logger.LogF("waiting for nodes %s to measure their throughput to this node...", strings.Join(pending, ", "))
+		time.Sleep(sleepInterval)
+	}
+}
+
+// pendingThroughputSources returns the sources which have not completed their
+// test yet.
+func pendingThroughputSources(sources []string) []string {
+	throughputServedMu.Lock()
+	defer throughputServedMu.Unlock()
+
+	pending := []string{}
+	for _, source := range sources {
+		if _, served := throughputServed[source]; !served {
+			pending = append(pending, source)
+		}
+	}
+
+	return pending
+}
+
+func nodeList(nodes string) []string {
+	list := []string{}
+	for _, node := range strings.Split(nodes, ",") {
+		if node != "" {
+			list = append(list, node)
+		}
+	}
+
+	return list
+}
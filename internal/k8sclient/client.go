@@ -11,6 +11,8 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"net/http"
+	"net/url"
 	"os"
 	"path"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -28,11 +30,6 @@ var (
 func init() {
 	scheme = runtime.NewScheme()
 	utilruntime.Must(monitoringv1.AddToScheme(scheme))
-
-	_, err := getConfig()
-	if err != nil {
-		panic(err)
-	}
 }
 
 func getConfig() (*rest.Config, error) {
@@ -50,7 +47,7 @@ func getConfig() (*rest.Config, error) {
 
 	if _, err := os.Stat(kubeConfigPath); errors.Is(err, os.ErrNotExist) {
 		var err error
-		config, err = rest.InClusterConfig()
+		config, err = InClusterConfig()
 		if err != nil {
 			return nil, err
 		}
@@ -69,6 +66,26 @@ func getConfig() (*rest.Config, error) {
 	return config, nil
 }
 
+// InClusterConfig returns the config of the agents' in-cluster client. The API
+// server is reached directly, the proxy settings the agents get for their
+// connectivity checks are ignored.
+func InClusterConfig() (*rest.Config, error) {
+	conf, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	conf.Proxy = func(*http.Request) (*url.URL, error) {
+		return nil, nil
+	}
+
+	return conf, nil
+}
+
+func RESTConfig() (*rest.Config, error) {
+	return getConfig()
+}
+
 func ClientSet() (*kubernetes.Clientset, error) {
 	if clientSet != nil {
 		return clientSet, nil
@@ -64,7 +64,7 @@ func Green(str string) string {
 	return formatColor(str, colorGreen)
 }
 
-func yellow(str string) string {
+func Yellow(str string) string {
 	return formatColor(str, colorYellow)
 }
 
@@ -83,11 +83,11 @@ func (l *Logger) ErrorF(format string, args ...interface{}) {
 }
 
 func (l *Logger) WarningF(format string, args ...interface{}) {
-	l.WriteStringF(yellow(WarningTag+" "+format), args...)
+	l.WriteStringF(Yellow(WarningTag+" "+format), args...)
 }
 
 func (l *Logger) Warning() {
-	l.WriteStringF(yellow(WarningTag))
+	l.WriteStringF(Yellow(WarningTag))
 }
 
 func (l *Logger) Pass() {
@@ -95,7 +95,7 @@ func (l *Logger) Pass() {
 }
 
 func (l *Logger) Skip() {
-	l.WriteStringF(yellow(SkipTag))
+	l.WriteStringF(Yellow(SkipTag))
 }
 
 func (l *Logger) Fail() {
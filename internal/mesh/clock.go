@@ -0,0 +1,73 @@
+package mesh
+
+import (
+	"time"
+
+	"github.com/run-ai/preinstall-diagnostics/internal/env"
+)
+
+const (
+	defaultClockSkewWarn = time.Second
+	defaultClockSkewFail = time.Minute
+)
+
+// PingResponse is returned by the agents' ping server, the timestamps allow
+// the caller to compensate the network latency when estimating the offset of
+// the clocks.
+type PingResponse struct {
+	// When the request was received
+	Received time.Time `json:"received"`
+	// When the response was sent
+	Sent time.Time `json:"sent"`
+}
+
+// ClockOffset estimates the offset of the peer's clock and the network round
+// trip time as NTP does, from the local request and response times and the
+// peer's receive and send times.
+func ClockOffset(requested time.Time, res PingResponse, responded time.Time) (offset, rtt time.Duration) {
+	offset = (res.Received.Sub(requested) + res.Sent.Sub(responded)) / 2
+	rtt = responded.Sub(requested) - res.Sent.Sub(res.Received)
+
+	return offset, rtt
+}
+
+// ClockSkewThresholds are the clock offsets above which a pair of clocks is
+// reported as a warning and as a failure.
+type ClockSkewThresholds struct {
+	Warn time.Duration
+	Fail time.Duration
+}
+
+func DefaultClockSkewThresholds() ClockSkewThresholds {
+	return ClockSkewThresholds{
+		Warn: defaultClockSkewWarn,
+		Fail: defaultClockSkewFail,
+	}
+}
+
+// ClockSkewThresholdsFromEnv returns the thresholds the agent was deployed
+// with.
+func ClockSkewThresholdsFromEnv() ClockSkewThresholds {
+	thresholds := DefaultClockSkewThresholds()
+
+	warn, err := time.ParseDuration(env.EnvOrDefault(env.ClockSkewWarnEnvVar, ""))
+	if err == nil {
+		thresholds.Warn = warn
+	}
+
+	fail, err := time.ParseDuration(env.EnvOrDefault(env.ClockSkewFailEnvVar, ""))
+	if err == nil {
+		thresholds.Fail = fail
+	}
+
+	return thresholds
+}
+
+// Check classifies a clock offset.
+func (t ClockSkewThresholds) Check(offset time.Duration) (warn, fail bool) {
+	if offset < 0 {
+		offset = -offset
+	}
+
+	return offset > t.Warn, offset > t.Fail
+}
@@ -0,0 +1,102 @@
+package mesh
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ConfigMapKey is the key of the agent's results ConfigMap holding the
+// connectivity of its node to every peer.
+const ConfigMapKey = "mesh"
+
+// PeerResult is the connectivity of an agent to the agent of a peer node.
+type PeerResult struct {
+	Node      string `json:"node"`
+	Pod       string `json:"pod"`
+	Reachable bool   `json:"reachable"`
+	// Last error when the peer could not be reached
+	Error string `json:"error,omitempty"`
+
+	// Number of successful pings the percentiles are computed from
+	Samples int           `json:"samples,omitempty"`
+	RTTP50  time.Duration `json:"rttP50,omitempty"`
+	RTTP90  time.Duration `json:"rttP90,omitempty"`
+	RTTMax  time.Duration `json:"rttMax,omitempty"`
+
+	// Peer clock minus local clock
+	ClockOffset      time.Duration `json:"clockOffset,omitempty"`
+	ClockSkewWarning bool          `json:"clockSkewWarning,omitempty"`
+	ClockSkewFailed  bool          `json:"clockSkewFailed,omitempty"`
+
+	// MTU of the local interface and largest unfragmented packet reaching
+	// the peer, 0 when unknown
+	InterfaceMTU int `json:"interfaceMTU,omitempty"`
+	PathMTU      int `json:"pathMTU,omitempty"`
+	// Error of a transfer larger than the MTU, which hangs when packets
+	// are dropped instead of fragmented
+	LargeTransferError string `json:"largeTransferError,omitempty"`
+}
+
+// MTUMismatch tells whether packets as large as the local interface allows
+// do not reach the peer.
+func (r PeerResult) MTUMismatch() bool {
+	return r.LargeTransferError != "" || (r.PathMTU > 0 && r.PathMTU < r.InterfaceMTU)
+}
+
+func (r PeerResult) String() string {
+	if !r.Reachable {
+		return fmt.Sprintf("%s: unreachable: %s", r.Node, r.Error)
+	}
+
+	description := fmt.Sprintf("%s: rtt p50 %s, p90 %s, max %s, clock offset %s",
+		r.Node, r.RTTP50, r.RTTP90, r.RTTMax, r.ClockOffset)
+	if r.ClockSkewFailed {
+		description += " (out of sync)"
+	} else if r.ClockSkewWarning {
+		description += " (skewed)"
+	}
+
+	if r.PathMTU > 0 {
+		description += fmt.Sprintf(", path MTU %d of interface MTU %d", r.PathMTU, r.InterfaceMTU)
+	}
+	if r.LargeTransferError != "" {
+		description += ", large transfers fail: " + r.LargeTransferError
+	}
+
+	return description
+}
+
+// Describe lists the connectivity to every peer, one per line.
+func Describe(peers []PeerResult) string {
+	lines := []string{}
+	for _, peer := range peers {
+		lines = append(lines, peer.String())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Percentile returns the nearest-rank percentile p (0-100) of the samples.
+func Percentile(samples []time.Duration, p float64) time.Duration {
+	if len(samples) == 0 {
+		return 0
+	}
+
+	sorted := append([]time.Duration{}, samples...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+
+	return sorted[rank]
+}
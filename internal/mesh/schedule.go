@@ -0,0 +1,142 @@
+package mesh
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// Schedule returns the peers every node probes when the mesh is sampled.
+//
+// Nodes are shuffled into a ring and every node probes the size nodes
+// following it, so that every node is probed and probes at least size peers.
+// On top of that, every node with a zone probes at least one node of every
+// other zone, the nodes of a zone taking turns as targets. The same seed
+// yields the same schedule.
+func Schedule(nodeNames []string, zones map[string]string, size int, seed int64) map[string][]string {
+	sorted := append([]string{}, nodeNames...)
+	sort.Strings(sorted)
+
+	rng := rand.New(rand.NewSource(seed))
+	ring := make([]string, len(sorted))
+	for i, j := range rng.Perm(len(sorted)) {
+		ring[i] = sorted[j]
+	}
+
+	if size > len(ring)-1 {
+		size = len(ring) - 1
+	}
+
+	peers := map[string]map[string]struct{}{}
+	for _, node := range ring {
+		peers[node] = map[string]struct{}{}
+	}
+
+	for i, node := range ring {
+		for offset := 1; offset <= size; offset++ {
+			peers[node][ring[(i+offset)%len(ring)]] = struct{}{}
+		}
+	}
+
+	nodesByZone := map[string][]string{}
+	for _, node := range sorted {
+		zone, found := zones[node]
+		if !found || zone == "" {
+			continue
+		}
+		nodesByZone[zone] = append(nodesByZone[zone], node)
+	}
+
+	zoneNames := []string{}
+	for zone := range nodesByZone {
+		zoneNames = append(zoneNames, zone)
+	}
+	sort.Strings(zoneNames)
+
+	// next target of every zone, starting at a random node
+	nextTarget := map[string]int{}
+	for _, zone := range zoneNames {
+		nextTarget[zone] = rng.Intn(len(nodesByZone[zone]))
+	}
+
+	for _, node := range ring {
+		zone := zones[node]
+		if zone == "" {
+			continue
+		}
+
+		probedZones := map[string]bool{}
+		for peer := range peers[node] {
+			probedZones[zones[peer]] = true
+		}
+
+		for _, to := range zoneNames {
+			if to == zone || probedZones[to] {
+				continue
+			}
+
+			targets := nodesByZone[to]
+			peers[node][targets[nextTarget[to]%len(targets)]] = struct{}{}
+			nextTarget[to]++
+		}
+	}
+
+	schedule := map[string][]string{}
+	for node, nodePeers := range peers {
+		schedule[node] = []string{}
+		for peer := range nodePeers {
+			schedule[node] = append(schedule[node], peer)
+		}
+		sort.Strings(schedule[node])
+	}
+
+	return schedule
+}
+
+// ParseNodePairs parses a comma separated list of source:target node pairs
+// into the targets of every source node.
+func ParseNodePairs(pairs string) (map[string][]string, error) {
+	targets := map[string][]string{}
+	for _, pair := range strings.Split(pairs, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		source, target, found := strings.Cut(pair, ":")
+		if !found || source == "" || target == "" || source == target {
+			return nil, fmt.Errorf("invalid node pair %q, expected <source node>:<target node>", pair)
+		}
+
+		targets[source] = append(targets[source], target)
+	}
+
+	return targets, nil
+}
+
+// UnknownNodes returns the nodes of the pairs which are not among the nodes,
+// sorted.
+func UnknownNodes(pairs map[string][]string, nodes []string) []string {
+	known := map[string]bool{}
+	for _, node := range nodes {
+		known[node] = true
+	}
+
+	unknown := map[string]bool{}
+	for source, targets := range pairs {
+		for _, node := range append([]string{source}, targets...) {
+			if !known[node] {
+				unknown[node] = true
+			}
+		}
+	}
+
+	names := []string{}
+	for node := range unknown {
+		names = append(names, node)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,62 @@
+package mesh
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestScheduleZones(t *testing.T) {
+	nodeNames := []string{}
+	zones := map[string]string{}
+	for _, zone := range []string{"zone-a", "zone-b", "zone-c"} {
+		for i := 1; i <= 5; i++ {
+			node := fmt.Sprintf("%s-node-%d", zone, i)
+			nodeNames = append(nodeNames, node)
+			zones[node] = zone
+		}
+	}
+	// a node without a zone label
+	nodeNames = append(nodeNames, "node-without-zone")
+
+	for seed := int64(0); seed < 20; seed++ {
+		t.Run(fmt.Sprintf("seed %d", seed), func(t *testing.T) {
+			schedule := Schedule(nodeNames, zones, 2, seed)
+
+			probed := map[string]bool{}
+			for _, node := range nodeNames {
+				peers := schedule[node]
+				if len(peers) < 2 {
+					t.Errorf("%s probes %d peers, want at least 2", node, len(peers))
+				}
+
+				peerZones := map[string]bool{}
+				for _, peer := range peers {
+					if peer == node {
+						t.Errorf("%s probes itself", node)
+					}
+					probed[peer] = true
+					peerZones[zones[peer]] = true
+				}
+
+				if zones[node] == "" {
+					continue
+				}
+				for _, zone := range []string{"zone-a", "zone-b", "zone-c"} {
+					if zone != zones[node] && !peerZones[zone] {
+						t.Errorf("%s probes no node of %s: %v", node, zone, peers)
+					}
+				}
+			}
+
+			for _, node := range nodeNames {
+				if !probed[node] {
+					t.Errorf("%s is not probed", node)
+				}
+			}
+		})
+	}
+
+	if fmt.Sprint(Schedule(nodeNames, zones, 2, 1)) != fmt.Sprint(Schedule(nodeNames, zones, 2, 1)) {
+		t.Errorf("the same seed yields different schedules")
+	}
+}
@@ -0,0 +1,255 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTimeout       = 10 * time.Second
+	defaultRetries       = 2
+	defaultRetryInterval = 2 * time.Second
+	defaultMaxRedirects  = 10
+)
+
+// StatusRange is an inclusive range of accepted HTTP status codes.
+type StatusRange struct {
+	Min int
+	Max int
+}
+
+func (r StatusRange) String() string {
+	if r.Min == r.Max {
+		return strconv.Itoa(r.Min)
+	}
+
+	return fmt.Sprintf("%d-%d", r.Min, r.Max)
+}
+
+// ParseStatusRanges parses comma separated status codes and ranges, e.g.
+// "200-399,401".
+func ParseStatusRanges(ranges string) ([]StatusRange, error) {
+	statusRanges := []StatusRange{}
+	for _, item := range strings.Split(ranges, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		minStr, maxStr, isRange := strings.Cut(item, "-")
+		if !isRange {
+			maxStr = minStr
+		}
+
+		min, err := strconv.Atoi(strings.TrimSpace(minStr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid status code range %q", item)
+		}
+
+		max, err := strconv.Atoi(strings.TrimSpace(maxStr))
+		if err != nil || max < min {
+			return nil, fmt.Errorf("invalid status code range %q", item)
+		}
+
+		statusRanges = append(statusRanges, StatusRange{Min: min, Max: max})
+	}
+
+	return statusRanges, nil
+}
+
+type Options struct {
+	// Timeout of a single attempt
+	Timeout time.Duration
+	// Additional attempts after a failed one
+	Retries       int
+	RetryInterval time.Duration
+	// Status codes considered a success, any status is accepted when empty
+	AcceptedStatus []StatusRange
+	MaxRedirects   int
+}
+
+// DefaultOptions accepts any non-error response, as most endpoints answer
+// unauthenticated requests with a redirect or an authorization error.
+func DefaultOptions() Options {
+	return Options{
+		Timeout:       defaultTimeout,
+		Retries:       defaultRetries,
+		RetryInterval: defaultRetryInterval,
+		AcceptedStatus: []StatusRange{
+			{Min: 200, Max: 499},
+		},
+		MaxRedirects: defaultMaxRedirects,
+	}
+}
+
+// HTTPResult holds the details of the last attempt of an HTTP probe.
+type HTTPResult struct {
+	URL      string
+	Proxy    string
+	Attempts int
+
+	StatusCode int
+	Redirects  []string
+
+	DNSLookup    time.Duration
+	TCPConnect   time.Duration
+	TLSHandshake time.Duration
+	TTFB         time.Duration
+
+	TLSVersion string
+	ALPN       string
+	TLS        *TLSInspection
+}
+
+func (r HTTPResult) String() string {
+	lines := []string{
+		"connection: " + r.Proxy,
+	}
+
+	if r.StatusCode != 0 {
+		lines = append(lines, fmt.Sprintf("status: %d (attempt %d)", r.StatusCode, r.Attempts))
+	}
+
+	for _, redirect := range r.Redirects {
+		lines = append(lines, "redirected to: "+redirect)
+	}
+
+	lines = append(lines, fmt.Sprintf("dns: %s, connect: %s, tls: %s, ttfb: %s",
+		formatDuration(r.DNSLookup), formatDuration(r.TCPConnect),
+		formatDuration(r.TLSHandshake), formatDuration(r.TTFB)))
+
+	if r.TLSVersion != "" {
+		tlsLine := "tls version: " + r.TLSVersion
+		if r.ALPN != "" {
+			tlsLine += ", alpn: " + r.ALPN
+		}
+		lines = append(lines, tlsLine)
+	}
+
+	if r.TLS != nil {
+		lines = append(lines, r.TLS.String())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// HTTP probes url with a GET request, retrying on failure. An error is
+// returned when the endpoint could not be reached or answered with a status
+// that is not accepted.
+func HTTP(url string, opts Options) (HTTPResult, error) {
+	var result HTTPResult
+	var err error
+
+	for attempt := 1; attempt <= opts.Retries+1; attempt++ {
+		result, err = httpAttempt(url, opts)
+		result.Attempts = attempt
+		if err == nil {
+			return result, nil
+		}
+
+		if attempt <= opts.Retries {
+			time.Sleep(opts.RetryInterval)
+		}
+	}
+
+	return result, err
+}
+
+func httpAttempt(url string, opts Options) (HTTPResult, error) {
+	result := HTTPResult{
+		URL:   url,
+		Proxy: DescribeProxy(url),
+	}
+
+	var start, dnsStart, connectStart, tlsStart time.Time
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone:  func(httptrace.DNSDoneInfo) { result.DNSLookup = time.Since(dnsStart) },
+		ConnectStart: func(string, string) {
+			connectStart = time.Now()
+		},
+		ConnectDone: func(string, string, error) {
+			result.TCPConnect = time.Since(connectStart)
+		},
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone: func(cs tls.ConnectionState, _ error) {
+			result.TLSHandshake = time.Since(tlsStart)
+			result.TLSVersion = tls.VersionName(cs.Version)
+			result.ALPN = cs.NegotiatedProtocol
+		},
+		GotFirstResponseByte: func() { result.TTFB = time.Since(start) },
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodGet, url, nil)
+	if err != nil {
+		return result, err
+	}
+
+	client := httpClient(&result.TLS)
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) > opts.MaxRedirects {
+			return fmt.Errorf("stopped after %d redirects", opts.MaxRedirects)
+		}
+
+		result.Redirects = append(result.Redirects, req.URL.String())
+		return nil
+	}
+
+	start = time.Now()
+	res, err := client.Do(req)
+	if err != nil {
+		return result, err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	result.StatusCode = res.StatusCode
+
+	if !statusAccepted(res.StatusCode, opts.AcceptedStatus) {
+		return result, fmt.Errorf("%s is not reachable, got status code %d, expected %s",
+			url, res.StatusCode, formatStatusRanges(opts.AcceptedStatus))
+	}
+
+	return result, nil
+}
+
+func statusAccepted(statusCode int, accepted []StatusRange) bool {
+	if len(accepted) == 0 {
+		return true
+	}
+
+	for _, r := range accepted {
+		if statusCode >= r.Min && statusCode <= r.Max {
+			return true
+		}
+	}
+
+	return false
+}
+
+func formatStatusRanges(ranges []StatusRange) string {
+	strs := []string{}
+	for _, r := range ranges {
+		strs = append(strs, r.String())
+	}
+
+	return strings.Join(strs, ",")
+}
+
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+
+	return d.Round(time.Millisecond).String()
+}
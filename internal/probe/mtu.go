@@ -0,0 +1,111 @@
+package probe
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	// Smallest MTU every IPv4 host must accept
+	minMTU = 576
+
+	ipv4HeaderSize = 20
+	ipv6HeaderSize = 40
+	udpHeaderSize  = 8
+
+	mtuProbeAttempts = 3
+)
+
+// ServeUDPEcho answers every datagram received on conn with the size of the
+// datagram, for PathMTU to tell which sizes get through.
+func ServeUDPEcho(conn net.PacketConn) error {
+	buf := make([]byte, 64*1024)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+
+		ack := make([]byte, 4)
+		binary.BigEndian.PutUint32(ack, uint32(n))
+		_, _ = conn.WriteTo(ack, addr)
+	}
+}
+
+// PathMTU finds the largest IP packet, up to maxMTU, that reaches the UDP
+// echo server at address (host:port) without being fragmented. The search
+// stops when ctx is done.
+func PathMTU(ctx context.Context, address string, maxMTU int, timeout time.Duration) (int, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return 0, err
+	}
+
+	conn, err := net.DialUDP("udp", nil, udpAddr)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	ipv6 := udpAddr.IP.To4() == nil
+	err = setDontFragment(conn, ipv6)
+	if err != nil {
+		return 0, err
+	}
+
+	headerSize := ipv4HeaderSize + udpHeaderSize
+	if ipv6 {
+		headerSize = ipv6HeaderSize + udpHeaderSize
+	}
+
+	if !echoes(conn, minMTU-headerSize, timeout) {
+		return 0, fmt.Errorf("no response to %d bytes packets", minMTU)
+	}
+
+	// binary search of the largest packet size that gets through
+	low, high := minMTU, maxMTU
+	for low < high {
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+
+		size := (low + high + 1) / 2
+		if echoes(conn, size-headerSize, timeout) {
+			low = size
+		} else {
+			high = size - 1
+		}
+	}
+
+	return low, nil
+}
+
+func echoes(conn *net.UDPConn, payloadSize int, timeout time.Duration) bool {
+	payload := make([]byte, payloadSize)
+	ack := make([]byte, 4)
+
+	for i := 0; i < mtuProbeAttempts; i++ {
+		_, err := conn.Write(payload)
+		if err != nil {
+			// EMSGSIZE, larger than the MTU of the local interface
+			return false
+		}
+
+		_ = conn.SetReadDeadline(time.Now().Add(timeout))
+		for {
+			n, err := conn.Read(ack)
+			if err != nil {
+				break
+			}
+			// acks of previous, slower attempts are skipped
+			if n == len(ack) && int(binary.BigEndian.Uint32(ack)) == payloadSize {
+				return true
+			}
+		}
+	}
+
+	return false
+}
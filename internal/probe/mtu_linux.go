@@ -0,0 +1,32 @@
+//go:build linux
+
+package probe
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// setDontFragment sets the DF flag on the datagrams sent on conn, ignoring
+// the path MTU cached by the kernel so that every size is actually probed.
+func setDontFragment(conn *net.UDPConn, ipv6 bool) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		if ipv6 {
+			sockErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_MTU_DISCOVER, unix.IPV6_PMTUDISC_PROBE)
+		} else {
+			sockErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_MTU_DISCOVER, unix.IP_PMTUDISC_PROBE)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	return sockErr
+}
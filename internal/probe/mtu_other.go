@@ -0,0 +1,13 @@
+//go:build !linux
+
+package probe
+
+import (
+	"fmt"
+	"net"
+)
+
+// setDontFragment is only supported on Linux, where the agents run.
+func setDontFragment(*net.UDPConn, bool) error {
+	return fmt.Errorf("path MTU discovery is only supported on Linux")
+}
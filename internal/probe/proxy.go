@@ -0,0 +1,76 @@
+package probe
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/run-ai/preinstall-diagnostics/internal/env"
+	"golang.org/x/net/http/httpproxy"
+)
+
+const (
+	directConnection = "direct"
+)
+
+// The agents get the proxy settings through their environment, the CLI
+// overrides them with the --proxy and --no-proxy flags.
+var proxyConfig = httpproxy.FromEnvironment()
+
+func SetProxy(proxy, noProxy string) {
+	proxyConfig = &httpproxy.Config{
+		HTTPProxy:  proxy,
+		HTTPSProxy: proxy,
+		NoProxy:    noProxy,
+	}
+}
+
+// ProxyFromEnv returns the proxy settings of the current process, used as
+// the defaults of the CLI flags.
+func ProxyFromEnv() (proxy, noProxy string) {
+	proxy = env.EnvOrDefault(env.HTTPSProxyEnvVar, env.EnvOrDefault(env.HTTPSProxyEnvVarLower, ""))
+	if proxy == "" {
+		proxy = env.EnvOrDefault(env.HTTPProxyEnvVar, env.EnvOrDefault(env.HTTPProxyEnvVarLower, ""))
+	}
+
+	noProxy = env.EnvOrDefault(env.NoProxyEnvVar, env.EnvOrDefault(env.NoProxyEnvVarLower, ""))
+
+	return proxy, noProxy
+}
+
+// ProxyConfigured reports whether any proxy is set, regardless of NO_PROXY.
+func ProxyConfigured() bool {
+	return proxyConfig.HTTPProxy != "" || proxyConfig.HTTPSProxy != ""
+}
+
+// ProxyForURL returns the proxy requests to u go through, or nil when they
+// are sent directly.
+func ProxyForURL(u *url.URL) (*url.URL, error) {
+	return proxyConfig.ProxyFunc()(u)
+}
+
+// DescribeProxy describes how the probes connect to rawURL, for the report.
+func DescribeProxy(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return directConnection
+	}
+
+	proxyURL, err := ProxyForURL(u)
+	if err != nil || proxyURL == nil {
+		return directConnection
+	}
+
+	return "proxy " + proxyURL.Redacted()
+}
+
+func httpClient(inspection **TLSInspection) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		return ProxyForURL(req.URL)
+	}
+	transport.TLSClientConfig = tlsConfig(inspection)
+
+	return &http.Client{
+		Transport: transport,
+	}
+}
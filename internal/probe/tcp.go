@@ -0,0 +1,114 @@
+package probe
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// TCPResult holds the details of a TCP or TLS-only probe.
+type TCPResult struct {
+	Address  string
+	Attempts int
+
+	TCPConnect   time.Duration
+	TLSHandshake time.Duration
+
+	TLSVersion string
+	ALPN       string
+	TLS        *TLSInspection
+}
+
+func (r TCPResult) String() string {
+	lines := []string{
+		fmt.Sprintf("connect: %s (attempt %d)", formatDuration(r.TCPConnect), r.Attempts),
+	}
+
+	if r.TLSVersion != "" {
+		lines = append(lines, fmt.Sprintf("tls: %s, tls version: %s", formatDuration(r.TLSHandshake), r.TLSVersion))
+	}
+
+	if r.TLS != nil {
+		lines = append(lines, r.TLS.String())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// TCP probes that a connection to address (host:port) can be established.
+func TCP(address string, opts Options) (TCPResult, error) {
+	return withRetries(opts, func() (TCPResult, error) {
+		return tcpAttempt(address, opts.Timeout, false)
+	})
+}
+
+// TLS probes that a TLS handshake with address (host:port) succeeds, without
+// sending any request.
+func TLS(address string, opts Options) (TCPResult, error) {
+	return withRetries(opts, func() (TCPResult, error) {
+		return tcpAttempt(address, opts.Timeout, true)
+	})
+}
+
+func withRetries(opts Options, attempt func() (TCPResult, error)) (TCPResult, error) {
+	var result TCPResult
+	var err error
+
+	for i := 1; i <= opts.Retries+1; i++ {
+		result, err = attempt()
+		result.Attempts = i
+		if err == nil {
+			return result, nil
+		}
+
+		if i <= opts.Retries {
+			time.Sleep(opts.RetryInterval)
+		}
+	}
+
+	return result, err
+}
+
+func tcpAttempt(address string, timeout time.Duration, handshake bool) (TCPResult, error) {
+	result := TCPResult{
+		Address: address,
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return result, err
+	}
+
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return result, err
+	}
+	defer conn.Close()
+	result.TCPConnect = time.Since(start)
+
+	if !handshake {
+		return result, nil
+	}
+
+	config := tlsConfig(&result.TLS)
+	config.ServerName = host
+
+	tlsConn := tls.Client(conn, config)
+	_ = tlsConn.SetDeadline(time.Now().Add(timeout))
+
+	start = time.Now()
+	err = tlsConn.Handshake()
+	if err != nil {
+		return result, err
+	}
+	result.TLSHandshake = time.Since(start)
+
+	cs := tlsConn.ConnectionState()
+	result.TLSVersion = tls.VersionName(cs.Version)
+	result.ALPN = cs.NegotiatedProtocol
+
+	return result, nil
+}
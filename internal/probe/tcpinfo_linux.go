@@ -0,0 +1,28 @@
+//go:build linux
+
+package probe
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// tcpRetransmits returns the retransmitted and sent segments of the
+// connection, from the kernel's TCP_INFO.
+func tcpRetransmits(conn *net.TCPConn) (uint32, uint32, bool) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, 0, false
+	}
+
+	var info *unix.TCPInfo
+	controlErr := raw.Control(func(fd uintptr) {
+		info, err = unix.GetsockoptTCPInfo(int(fd), unix.IPPROTO_TCP, unix.TCP_INFO)
+	})
+	if controlErr != nil || err != nil {
+		return 0, 0, false
+	}
+
+	return info.Total_retrans, info.Segs_out, true
+}
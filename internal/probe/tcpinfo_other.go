@@ -0,0 +1,12 @@
+//go:build !linux
+
+package probe
+
+import (
+	"net"
+)
+
+// tcpRetransmits is only supported on Linux, where the agents run.
+func tcpRetransmits(*net.TCPConn) (uint32, uint32, bool) {
+	return 0, 0, false
+}
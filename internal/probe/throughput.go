@@ -0,0 +1,184 @@
+package probe
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const throughputBufferSize = 128 * 1024
+
+// ThroughputResult holds the outcome of a throughput test, as measured by the
+// receiving side.
+type ThroughputResult struct {
+	Address  string
+	Bytes    int64
+	Duration time.Duration
+
+	// Retransmitted and sent segments of the sending socket, known on Linux
+	// only
+	TCPInfo      bool
+	Retransmits  uint32
+	SegmentsSent uint32
+}
+
+// Gbps returns the throughput in Gbit/s.
+func (r ThroughputResult) Gbps() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+
+	return float64(r.Bytes) * 8 / r.Duration.Seconds() / 1e9
+}
+
+func (r ThroughputResult) String() string {
+	str := fmt.Sprintf("%.2f Gbit/s (%d MB in %s)",
+		r.Gbps(), r.Bytes/1e6, r.Duration.Round(time.Millisecond))
+
+	if r.TCPInfo {
+		str += fmt.Sprintf(", %d retransmits", r.Retransmits)
+		if r.SegmentsSent > 0 {
+			str += fmt.Sprintf(" (%.3f%% of segments)", float64(r.Retransmits)*100/float64(r.SegmentsSent))
+		}
+	}
+
+	return str
+}
+
+// throughputHeaderSize bounds the line naming the sender, sent before the data.
+const throughputHeaderSize = 256
+
+// throughputReport is sent back by the receiver once the sender is done.
+type throughputReport struct {
+	Bytes    int64         `json:"bytes"`
+	Duration time.Duration `json:"duration"`
+}
+
+// ServeThroughput receives throughput tests on the listener until it is
+// closed, calling served with the name of the sender after every completed
+// test.
+func ServeThroughput(listener net.Listener, served func(source string)) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			defer conn.Close()
+			source, err := receiveThroughput(conn)
+			if err == nil {
+				served(source)
+			}
+		}()
+	}
+}
+
+func receiveThroughput(conn net.Conn) (string, error) {
+	reader := bufio.NewReaderSize(conn, throughputBufferSize)
+	header, err := reader.ReadSlice('\n')
+	if err != nil {
+		return "", fmt.Errorf("could not read the throughput sender: %v", err)
+	}
+	if len(header) > throughputHeaderSize {
+		return "", fmt.Errorf("throughput sender of %d bytes is too long", len(header))
+	}
+	source := strings.TrimSpace(string(header[:len(header)-1]))
+
+	buf := make([]byte, throughputBufferSize)
+
+	report := throughputReport{}
+	var start time.Time
+	for {
+		n, err := reader.Read(buf)
+		if n > 0 && start.IsZero() {
+			start = time.Now()
+		}
+		report.Bytes += int64(n)
+		if err != nil {
+			break
+		}
+	}
+
+	if !start.IsZero() {
+		report.Duration = time.Since(start)
+	}
+
+	return source, json.NewEncoder(conn).Encode(report)
+}
+
+// Throughput sends data to the throughput server at address (host:port) for
+// the duration, and returns the throughput measured by the server. The server
+// is told that the data comes from source.
+func Throughput(address, source string, duration time.Duration, opts Options) (ThroughputResult, error) {
+	var result ThroughputResult
+	var err error
+
+	for i := 1; i <= opts.Retries+1; i++ {
+		result, err = throughputAttempt(address, source, duration, opts.Timeout)
+		if err == nil {
+			return result, nil
+		}
+
+		if i <= opts.Retries {
+			time.Sleep(opts.RetryInterval)
+		}
+	}
+
+	return result, err
+}
+
+func throughputAttempt(address, source string, duration, timeout time.Duration) (ThroughputResult, error) {
+	result := ThroughputResult{
+		Address: address,
+	}
+
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return result, err
+	}
+	defer conn.Close()
+
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return result, fmt.Errorf("not a TCP connection")
+	}
+	_ = tcpConn.SetDeadline(time.Now().Add(duration + timeout))
+
+	if len(source)+1 > throughputHeaderSize || strings.ContainsRune(source, '\n') {
+		return result, fmt.Errorf("invalid throughput source %q", source)
+	}
+	_, err = fmt.Fprintf(tcpConn, "%s\n", source)
+	if err != nil {
+		return result, err
+	}
+
+	buf := make([]byte, throughputBufferSize)
+	for start := time.Now(); time.Since(start) < duration; {
+		_, err := tcpConn.Write(buf)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	err = tcpConn.CloseWrite()
+	if err != nil {
+		return result, err
+	}
+
+	report := throughputReport{}
+	err = json.NewDecoder(io.LimitReader(tcpConn, throughputBufferSize)).Decode(&report)
+	if err != nil {
+		return result, fmt.Errorf("could not read the throughput report: %v", err)
+	}
+
+	result.Bytes = report.Bytes
+	result.Duration = report.Duration
+	result.Retransmits, result.SegmentsSent, result.TCPInfo = tcpRetransmits(tcpConn)
+
+	return result, nil
+}
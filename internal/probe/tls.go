@@ -0,0 +1,216 @@
+package probe
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/run-ai/preinstall-diagnostics/internal/env"
+)
+
+// Public CAs known to issue the certificates of some hosts, used to tell a
+// TLS-inspecting proxy from a legitimate but unexpected CA
+var expectedIssuers = map[string]string{
+	"googleapis.com": "Google Trust Services",
+	"gcr.io":         "Google Trust Services",
+}
+
+// Organizations of the roots of the widely used public CAs. A proxy whose CA
+// was added to the system roots passes verification, but its root is none of
+// these.
+var publicRootOrganizations = []string{
+	"Amazon",
+	"Baltimore",
+	"Certainly",
+	"COMODO",
+	"DigiCert",
+	"Entrust",
+	"GlobalSign",
+	"GoDaddy",
+	"Google Trust Services",
+	"IdenTrust",
+	"Internet Security Research Group",
+	"Microsoft",
+	"Sectigo",
+	"SSL Corporation",
+	"Starfield",
+	"The USERTRUST Network",
+}
+
+var (
+	systemRoots = loadSystemRoots()
+	caBundle    = loadCABundleFromEnv()
+)
+
+// TLSInspection describes the certificate chain presented by an endpoint.
+type TLSInspection struct {
+	Issuer string
+	// Whether the chain is trusted by the public roots alone, without the
+	// custom CA bundle
+	PublicCA bool
+	// Whether the chain is trusted by a CA of the custom CA bundle other than
+	// the public ones, which belongs to the intercepting proxy
+	BundleCA bool
+	// The expected issuer organization when the presented one differs
+	UnexpectedIssuer string
+	// The root the chain was verified against when it is not a widely used
+	// public CA
+	UnknownRoot string
+}
+
+func (i TLSInspection) String() string {
+	str := "issuer: " + i.Issuer
+	if i.BundleCA {
+		str += "\nissuer is a CA of the CA bundle, TLS is intercepted by a proxy or firewall " +
+			"and the Run:ai cluster components will need its CA as well"
+	} else if !i.PublicCA {
+		str += "\nissuer is not a public CA, TLS is likely intercepted by a proxy or firewall " +
+			"and the Run:ai cluster components will need its CA as well"
+	} else if i.UnexpectedIssuer != "" {
+		str += fmt.Sprintf("\nissuer was expected to be %s, TLS may be intercepted", i.UnexpectedIssuer)
+	} else if i.UnknownRoot != "" {
+		str += fmt.Sprintf("\nroot %s is not a widely used public CA, TLS may be intercepted "+
+			"by a proxy whose CA is in the system roots", i.UnknownRoot)
+	}
+
+	return str
+}
+
+// SetCABundle adds the PEM encoded certificates to the roots trusted by the
+// HTTPS probes.
+func SetCABundle(pemCerts []byte) error {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemCerts) {
+		return fmt.Errorf("no certificates found in the CA bundle")
+	}
+
+	caBundle = pemCerts
+	return nil
+}
+
+func loadSystemRoots() *x509.CertPool {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		return x509.NewCertPool()
+	}
+
+	return pool
+}
+
+// The agents get the CA bundle mounted from a ConfigMap
+func loadCABundleFromEnv() []byte {
+	path := env.EnvOrDefault(env.CABundleEnvVar, "")
+	if path == "" {
+		return nil
+	}
+
+	pemCerts, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	return pemCerts
+}
+
+func trustedRoots() *x509.CertPool {
+	pool := systemRoots.Clone()
+	if caBundle != nil {
+		pool.AppendCertsFromPEM(caBundle)
+	}
+
+	return pool
+}
+
+// tlsConfig verifies peers against the public roots and the CA bundle, and
+// records the presented chain in inspection even when verification fails.
+func tlsConfig(inspection **TLSInspection) *tls.Config {
+	return &tls.Config{
+		// verification is done by VerifyConnection so that the chain can be
+		// inspected before a handshake failure
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			*inspection = inspectChain(cs.ServerName, cs.PeerCertificates)
+
+			_, err := verifyChain(cs.ServerName, cs.PeerCertificates, trustedRoots())
+			return err
+		},
+	}
+}
+
+func inspectChain(serverName string, certs []*x509.Certificate) *TLSInspection {
+	if len(certs) == 0 {
+		return nil
+	}
+
+	top := certs[len(certs)-1]
+	inspection := &TLSInspection{
+		Issuer: top.Issuer.String(),
+	}
+
+	if caBundle != nil {
+		bundle := x509.NewCertPool()
+		bundle.AppendCertsFromPEM(caBundle)
+		// bundles often hold the public roots as well
+		bundleChains, err := verifyChain(serverName, certs, bundle)
+		if err == nil {
+			chain := bundleChains[0]
+			inspection.BundleCA = !publicRoot(strings.Join(chain[len(chain)-1].Subject.Organization, " "))
+		}
+	}
+
+	chains, err := verifyChain(serverName, certs, systemRoots)
+	inspection.PublicCA = err == nil
+
+	root := top
+	if len(chains) > 0 {
+		chain := chains[0]
+		root = chain[len(chain)-1]
+	}
+	rootOrganization := strings.Join(root.Subject.Organization, " ")
+	topIssuerOrganization := strings.Join(top.Issuer.Organization, " ")
+
+	for domain, issuer := range expectedIssuers {
+		if serverName != domain && !strings.HasSuffix(serverName, "."+domain) {
+			continue
+		}
+
+		if !strings.Contains(rootOrganization, issuer) && !strings.Contains(topIssuerOrganization, issuer) {
+			inspection.UnexpectedIssuer = issuer
+		}
+	}
+
+	if inspection.PublicCA && !publicRoot(rootOrganization) {
+		inspection.UnknownRoot = root.Subject.String()
+	}
+
+	return inspection
+}
+
+func publicRoot(organization string) bool {
+	for _, public := range publicRootOrganizations {
+		if strings.Contains(organization, public) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func verifyChain(serverName string, certs []*x509.Certificate, roots *x509.CertPool) ([][]*x509.Certificate, error) {
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates presented by %s", serverName)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	return certs[0].Verify(x509.VerifyOptions{
+		DNSName:       serverName,
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+}
@@ -0,0 +1,127 @@
+package probe
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	dnsPort = "53"
+	ntpPort = "123"
+
+	udpMaxResponseSize = 1500
+)
+
+// UDPResult holds the details of a UDP request/response probe.
+type UDPResult struct {
+	Address  string
+	Attempts int
+
+	RTT           time.Duration
+	ResponseBytes int
+}
+
+func (r UDPResult) String() string {
+	return fmt.Sprintf("rtt: %s, response: %d bytes (attempt %d)",
+		formatDuration(r.RTT), r.ResponseBytes, r.Attempts)
+}
+
+// UDP sends a request to address (host:port) and waits for any response. As
+// UDP is connectionless, only a response proves reachability, so well known
+// ports get a valid request: a DNS query on 53 and an NTP request on 123.
+// payload is sent to other ports.
+func UDP(address, payload string, opts Options) (UDPResult, error) {
+	var result UDPResult
+	var err error
+
+	for attempt := 1; attempt <= opts.Retries+1; attempt++ {
+		result, err = udpAttempt(address, payload, opts.Timeout)
+		result.Attempts = attempt
+		if err == nil {
+			return result, nil
+		}
+
+		if attempt <= opts.Retries {
+			time.Sleep(opts.RetryInterval)
+		}
+	}
+
+	return result, err
+}
+
+func udpAttempt(address, payload string, timeout time.Duration) (UDPResult, error) {
+	result := UDPResult{
+		Address: address,
+	}
+
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return result, err
+	}
+
+	conn, err := net.DialTimeout("udp", address, timeout)
+	if err != nil {
+		return result, err
+	}
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	start := time.Now()
+	_, err = conn.Write(udpRequest(port, payload))
+	if err != nil {
+		return result, err
+	}
+
+	response := make([]byte, udpMaxResponseSize)
+	n, err := conn.Read(response)
+	if err != nil {
+		if strings.Contains(err.Error(), "refused") {
+			return result, fmt.Errorf("port %s is closed on %s: %v", port, address, err)
+		}
+		return result, fmt.Errorf("no response from %s: %v", address, err)
+	}
+
+	result.RTT = time.Since(start)
+	result.ResponseBytes = n
+
+	return result, nil
+}
+
+func udpRequest(port, payload string) []byte {
+	switch {
+	case payload != "":
+		return []byte(payload)
+	case port == dnsPort:
+		return dnsRootQuery()
+	case port == ntpPort:
+		return ntpRequest()
+	default:
+		return []byte{0}
+	}
+}
+
+// dnsRootQuery is a recursive query for the NS records of the root zone.
+func dnsRootQuery() []byte {
+	query := make([]byte, 12, 17)
+	binary.BigEndian.PutUint16(query[0:], 0x5244) // ID
+	binary.BigEndian.PutUint16(query[2:], 0x0100) // recursion desired
+	binary.BigEndian.PutUint16(query[4:], 1)      // one question
+
+	query = append(query, 0)    // root name
+	query = append(query, 0, 2) // type NS
+	query = append(query, 0, 1) // class IN
+
+	return query
+}
+
+// ntpRequest is an SNTP v4 client request.
+func ntpRequest() []byte {
+	request := make([]byte, 48)
+	request[0] = 0x23 // LI 0, version 4, mode 3 (client)
+
+	return request
+}
@@ -0,0 +1,100 @@
+package progress
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/run-ai/preinstall-diagnostics/internal/log"
+	"golang.org/x/term"
+)
+
+type AgentCounts struct {
+	Total     int
+	Scheduled int
+	Running   int
+	Reporting int
+	Completed int
+	Failed    int
+}
+
+func (c AgentCounts) String() string {
+	return fmt.Sprintf("agents: %d/%d completed, %d scheduled, %d running, %d reporting, %d failed",
+		c.Completed, c.Total, c.Scheduled, c.Running, c.Reporting, c.Failed)
+}
+
+// Progress reports the state of a diagnostics run while it executes. On a
+// terminal the agent counts are redrawn in place, otherwise every change is
+// written as a plain log line.
+type Progress struct {
+	logger *log.Logger
+	tty    bool
+
+	mu         sync.Mutex
+	statusLine string
+}
+
+func NewProgress(logger *log.Logger) *Progress {
+	return &Progress{
+		logger: logger,
+		tty:    term.IsTerminal(int(os.Stdout.Fd())),
+	}
+}
+
+func (p *Progress) CheckDone(name string, pass bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result := log.Green(log.PassTag)
+	if !pass {
+		result = log.Red(log.FailTag)
+	}
+
+	p.clearStatusLine()
+	p.logger.LogF("%s %s", result, name)
+	p.redrawStatusLine()
+}
+
+func (p *Progress) AgentsUpdate(counts AgentCounts) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	statusLine := counts.String()
+	if statusLine == p.statusLine {
+		return
+	}
+
+	if p.tty {
+		p.clearStatusLine()
+		p.statusLine = statusLine
+		p.redrawStatusLine()
+		return
+	}
+
+	p.statusLine = statusLine
+	p.logger.LogF("%s", statusLine)
+}
+
+// Done terminates the in-place status line so that following output starts
+// on a fresh line.
+func (p *Progress) Done() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.tty && p.statusLine != "" {
+		fmt.Println()
+	}
+	p.statusLine = ""
+}
+
+func (p *Progress) clearStatusLine() {
+	if p.tty && p.statusLine != "" {
+		fmt.Print("\r\033[K")
+	}
+}
+
+func (p *Progress) redrawStatusLine() {
+	if p.tty && p.statusLine != "" {
+		fmt.Print(log.LogTag + " " + p.statusLine)
+	}
+}
@@ -1,11 +1,9 @@
 package registry
 
 import (
-	"fmt"
-	"net/http"
-
 	"github.com/run-ai/preinstall-diagnostics/internal/env"
 	"github.com/run-ai/preinstall-diagnostics/internal/log"
+	"github.com/run-ai/preinstall-diagnostics/internal/probe"
 )
 
 const (
@@ -23,15 +21,12 @@ func CheckRunAIRegistryReachable(logger *log.Logger) error {
 
 	logger.TitleF("Connectivity to runai container registry: %s", registry)
 
-	res, err := http.Get(registry)
+	result, err := probe.HTTP(registry, probe.DefaultOptions())
+	logger.LogF("%s", result.String())
 	if err != nil {
 		return err
 	}
 
-	if res.StatusCode >= 400 && res.StatusCode < 200 {
-		return fmt.Errorf("status code of %d was returned from %s", res.StatusCode, registry)
-	}
-
 	logger.LogF("Run:AI container registry is accessible")
 	return nil
 }
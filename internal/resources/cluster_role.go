@@ -5,89 +5,89 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-var ClusterRole = rbacv1.ClusterRole{
-	TypeMeta: metav1.TypeMeta{
-		APIVersion: rbacGV,
-		Kind:       "ClusterRole",
-	},
-	ObjectMeta: metav1.ObjectMeta{
-		Name: defaultResourceName,
-		Labels: map[string]string{
-			defaultResourceName: "",
+func templateClusterRole(names Names) *rbacv1.ClusterRole {
+	return &rbacv1.ClusterRole{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: rbacGV,
+			Kind:       "ClusterRole",
 		},
-	},
-	Rules: []rbacv1.PolicyRule{
-		{
-			APIGroups: []string{
-				"",
-			},
-			Resources: []string{
-				"pods",
-				"nodes",
-				"secrets",
-			},
-			Verbs: []string{
-				"get",
-				"list",
-			},
-		},
-		{
-			APIGroups: []string{
-				"batch",
-			},
-			Resources: []string{
-				"jobs",
-			},
-			Verbs: []string{
-				"get",
-				"list",
-			},
-		},
-		{
-			APIGroups: []string{
-				"apps",
-			},
-			Resources: []string{
-				"daemonsets",
-				"deployments",
-			},
-			Verbs: []string{
-				"get",
-				"list",
-			},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   names.ForRun(),
+			Labels: names.Labels(),
 		},
-		{
-			APIGroups: []string{
-				"config.openshift.io",
-			},
-			Resources: []string{
-				"clusterversions",
-			},
-			Verbs: []string{
-				"get",
-			},
-		},
-		{
-			APIGroups: []string{
-				"monitoring.coreos.com",
-			},
-			Resources: []string{
-				"prometheuses",
-			},
-			Verbs: []string{
-				"list",
-			},
-		},
-		{
-			APIGroups: []string{
-				"storage.k8s.io",
-			},
-			Resources: []string{
-				"storageclasses",
-			},
-			Verbs: []string{
-				"list",
+		Rules: []rbacv1.PolicyRule{
+			{
+				APIGroups: []string{
+					"",
+				},
+				Resources: []string{
+					"pods",
+					"nodes",
+					"secrets",
+				},
+				Verbs: []string{
+					"get",
+					"list",
+				},
+			},
+			{
+				APIGroups: []string{
+					"batch",
+				},
+				Resources: []string{
+					"jobs",
+				},
+				Verbs: []string{
+					"get",
+					"list",
+				},
+			},
+			{
+				APIGroups: []string{
+					"apps",
+				},
+				Resources: []string{
+					"daemonsets",
+					"deployments",
+				},
+				Verbs: []string{
+					"get",
+					"list",
+				},
+			},
+			{
+				APIGroups: []string{
+					"config.openshift.io",
+				},
+				Resources: []string{
+					"clusterversions",
+				},
+				Verbs: []string{
+					"get",
+				},
+			},
+			{
+				APIGroups: []string{
+					"monitoring.coreos.com",
+				},
+				Resources: []string{
+					"prometheuses",
+				},
+				Verbs: []string{
+					"list",
+				},
+			},
+			{
+				APIGroups: []string{
+					"storage.k8s.io",
+				},
+				Resources: []string{
+					"storageclasses",
+				},
+				Verbs: []string{
+					"list",
+				},
 			},
 		},
-	},
+	}
 }
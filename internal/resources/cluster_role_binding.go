@@ -5,27 +5,27 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-var ClusterRoleBinding = rbacv1.ClusterRoleBinding{
-	TypeMeta: metav1.TypeMeta{
-		APIVersion: rbacGV,
-		Kind:       "ClusterRoleBinding",
-	},
-	ObjectMeta: metav1.ObjectMeta{
-		Name: defaultResourceName,
-		Labels: map[string]string{
-			defaultResourceName: "",
+func templateClusterRoleBinding(names Names) *rbacv1.ClusterRoleBinding {
+	return &rbacv1.ClusterRoleBinding{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: rbacGV,
+			Kind:       "ClusterRoleBinding",
 		},
-	},
-	RoleRef: rbacv1.RoleRef{
-		APIGroup: rbacAPIGroup,
-		Kind:     ClusterRole.Kind,
-		Name:     ClusterRole.Name,
-	},
-	Subjects: []rbacv1.Subject{
-		{
-			Kind:      ServiceAccount.Kind,
-			Name:      ServiceAccount.Name,
-			Namespace: ServiceAccount.Namespace,
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   names.ForRun(),
+			Labels: names.Labels(),
 		},
-	},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacAPIGroup,
+			Kind:     "ClusterRole",
+			Name:     names.ForRun(),
+		},
+		Subjects: []rbacv1.Subject{
+			{
+				Kind:      rbacv1.ServiceAccountKind,
+				Name:      names.ForRun(),
+				Namespace: names.Namespace,
+			},
+		},
+	}
 }
@@ -0,0 +1,29 @@
+package resources
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	caBundleKey       = "ca.crt"
+	caBundleVolume    = "ca-bundle"
+	caBundleMountPath = "/etc/runai-diagnostics/ca-bundle"
+)
+
+func templateCABundleConfigMap(names Names, caBundle []byte) *v1.ConfigMap {
+	return &v1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: coreAPIVersion,
+			Kind:       "ConfigMap",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      names.ForCABundle(),
+			Namespace: names.Namespace,
+			Labels:    names.Labels(),
+		},
+		Data: map[string]string{
+			caBundleKey: string(caBundle),
+		},
+	}
+}
@@ -3,7 +3,12 @@ package resources
 import "github.com/run-ai/preinstall-diagnostics/internal/registry"
 
 const (
-	defaultResourceName = "runai-diagnostics"
+	DefaultNamespace  = "runai-diagnostics"
+	DefaultNamePrefix = "runai-diagnostics"
+
+	// AppLabel marks every resource deployed by the tool, regardless of the
+	// namespace and name prefix in use
+	AppLabel = "runai-diagnostics"
 
 	rbacAPIGroup   = "rbac.authorization.k8s.io"
 	rbacAPIVersion = "v1"
@@ -2,16 +2,21 @@ package resources
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/pkg/errors"
+	"github.com/run-ai/preinstall-diagnostics/internal/egress"
 	"github.com/run-ai/preinstall-diagnostics/internal/env"
 	"github.com/run-ai/preinstall-diagnostics/internal/k8sclient"
+	"github.com/run-ai/preinstall-diagnostics/internal/mesh"
 	v1 "k8s.io/api/core/v1"
-	"k8s.io/utils/ptr"
+	"sort"
 	"strings"
+	"time"
 
 	pluralize "github.com/gertd/go-pluralize"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -35,34 +40,6 @@ func PrintResources(objs []client.Object) error {
 	return nil
 }
 
-func DeleteResources(objs []client.Object, kubeDynamicClient dynamic.Interface) error {
-	for _, res := range objs {
-		gvk := res.GetObjectKind().GroupVersionKind()
-		gvs := schema.GroupVersionResource{
-			Group:    strings.ToLower(gvk.Group),
-			Version:  strings.ToLower(gvk.Version),
-			Resource: pluralize.NewClient().Pluralize(strings.ToLower(gvk.Kind), 2, false),
-		}
-
-		err := kubeDynamicClient.Resource(gvs).
-			Namespace(res.GetNamespace()).
-			Delete(context.TODO(),
-				res.GetName(),
-				metav1.DeleteOptions{
-					PropagationPolicy: ptr.To(metav1.DeletePropagationBackground),
-				})
-
-		if err != nil {
-			if !kerrors.IsNotFound(err) {
-				return errors.Wrap(err,
-					fmt.Sprintf("delete error: resource kind: %s", gvk.Kind))
-			}
-		}
-	}
-
-	return nil
-}
-
 func CreateResources(objs []client.Object, kubeDynamicClient dynamic.Interface) error {
 	for _, res := range objs {
 		unstructuredObj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(res)
@@ -92,8 +69,115 @@ func CreateResources(objs []client.Object, kubeDynamicClient dynamic.Interface)
 	return nil
 }
 
-func TemplateResources(backendFQDN, image, imagePullSecretName,
-	imageRegistry, runaiSaas string, airgapped bool) (creationOrder, deletionOrder []client.Object) {
+// TemplateOptions holds everything that can be customized in the deployed
+// diagnostics resources.
+type TemplateOptions struct {
+	BackendFQDN         string
+	Image               string
+	ImagePullSecretName string
+	ImageRegistry       string
+	RunAISaas           string
+	Airgapped           bool
+
+	AgentResources    v1.ResourceRequirements
+	PriorityClassName string
+	ImagePullPolicy   v1.PullPolicy
+
+	Proxy   string
+	NoProxy string
+
+	Endpoints []egress.Endpoint
+	// Number of nodes probing the endpoints with the sample scope
+	EndpointSampleSize int
+
+	// Number of peers every agent pings, all agents ping each other when 0
+	MeshSampleSize int
+	// Measures the throughput between pairs of nodes for ThroughputDuration
+	Throughput         bool
+	ThroughputDuration time.Duration
+	// Nodes every node sends to, one peer per node picked for the run when
+	// empty
+	ThroughputPairs map[string][]string
+
+	// Deploys a second agent per node on the host network, to tell CNI
+	// issues from host and firewall issues
+	HostNetwork bool
+
+	// Mounts host directories read-only into the agents to inspect the
+	// host settings
+	HostInspection bool
+
+	// Clock offsets between nodes reported as a warning and as a failure
+	ClockSkew mesh.ClockSkewThresholds
+
+	// PEM encoded certificates trusted by the agents' HTTPS probes in
+	// addition to the public roots
+	CABundle []byte
+
+	// OpenShift deploys a dedicated SecurityContextConstraints for the agents
+	OpenShift bool
+
+	Names Names
+	// When set, the namespace is expected to exist already and is neither
+	// created nor labelled by the tool
+	UseExistingNamespace bool
+}
+
+const (
+	// Time the agents take to run every check but the measurement of their
+	// peers and the throughput tests, AgentsStartTimeout included
+	agentsTimeout = 5 * time.Minute
+	// AgentsStartTimeout is how long an agent waits for the agents of the
+	// other nodes to get ready before measuring them
+	AgentsStartTimeout = 2 * time.Minute
+	// Time a throughput test takes to connect and report on top of its
+	// duration
+	throughputTestOverhead = 15 * time.Second
+	// ThroughputSourcesTimeout is how long an agent waits for its sources to
+	// run their tests once its own tests are done
+	ThroughputSourcesTimeout = 3 * time.Minute
+
+	// MeshConcurrency is how many peers an agent measures at once
+	MeshConcurrency = 8
+	// PeerMeasurementTimeout bounds the measurement of a peer by an agent,
+	// mostly path MTU probes of sizes that do not get through
+	PeerMeasurementTimeout = 30 * time.Second
+	// Time an agent keeps retrying unreachable peers on top of the
+	// measurement of every peer
+	meshRetryTimeout = 2 * time.Minute
+)
+
+// MeshTimeout returns how long an agent measures the given number of peers,
+// MeshConcurrency at a time, retrying the unreachable ones.
+func MeshTimeout(peers int) time.Duration {
+	return meshRetryTimeout + time.Duration((peers+MeshConcurrency-1)/MeshConcurrency)*PeerMeasurementTimeout
+}
+
+// AgentsTimeout returns how long the agents of a cluster of the given number
+// of nodes and zones are given to complete their checks. Every agent
+// measures its peers within MeshTimeout. Every node runs its throughput tests
+// one after the other, then waits for the nodes sending to it.
+func (opts TemplateOptions) AgentsTimeout(nodes, zones int) time.Duration {
+	peers := nodes
+	if opts.MeshSampleSize > 0 {
+		// sampled peers, along with peers in the other zones
+		peers = min(peers, opts.MeshSampleSize+zones)
+	}
+
+	timeout := agentsTimeout + MeshTimeout(peers)
+	if opts.Throughput {
+		targets := 1
+		for _, nodeTargets := range opts.ThroughputPairs {
+			targets = max(targets, len(nodeTargets))
+		}
+		timeout += time.Duration(targets)*(opts.ThroughputDuration+throughputTestOverhead) +
+			ThroughputSourcesTimeout
+	}
+
+	return timeout
+}
+
+func TemplateResources(opts TemplateOptions) (creationOrder []client.Object) {
 	creationOrder = []client.Object{}
 
 	k8s, err := k8sclient.ClientSet()
@@ -107,21 +191,116 @@ func TemplateResources(backendFQDN, image, imagePullSecretName,
 	}
 
 	nodeNames := []string{}
+	zones := map[string]string{}
+	nodes := map[string]v1.Node{}
 	for _, node := range nodeList.Items {
+		nodes[node.Name] = node
 		nodeNames = append(nodeNames, node.Name)
+		zones[node.Name] = node.Labels[v1.LabelTopologyZone]
+	}
+
+	var throughputTargets, throughputSources map[string][]string
+	if opts.Throughput {
+		throughputTargets = opts.ThroughputPairs
+		if len(throughputTargets) == 0 {
+			throughputTargets = mesh.Schedule(nodeNames, nil, 1, opts.Names.Seed())
+		}
+
+		throughputSources = map[string][]string{}
+		for source, targets := range throughputTargets {
+			for _, target := range targets {
+				throughputSources[target] = append(throughputSources[target], source)
+			}
+		}
 	}
 
-	jobs := TemplateJobsForNodes(nodeNames, backendFQDN)
+	jobs := TemplateJobsForNodes(nodeNames, opts.Names, opts.BackendFQDN, NetworkPod)
+	if opts.HostNetwork {
+		jobs = append(jobs, TemplateJobsForNodes(nodeNames, opts.Names, opts.BackendFQDN, NetworkHost)...)
+	}
+
+	sample := egress.SampleNodes(nodeNames, opts.EndpointSampleSize, opts.Names.Seed())
+
+	var meshSchedule map[string][]string
+	if opts.MeshSampleSize > 0 {
+		meshSchedule = mesh.Schedule(nodeNames, zones, opts.MeshSampleSize, opts.Names.Seed())
+	}
 
 	for _, job := range jobs {
-		if imagePullSecretName != "" {
+		nodeName := job.Spec.Template.Spec.NodeName
+
+		_, inSample := sample[nodeName]
+		endpointsJSON, err := json.Marshal(egress.ForNode(opts.Endpoints, inSample))
+		if err != nil {
+			panic(err)
+		}
+
+		job.Spec.Template.Spec.Containers[0].Env =
+			append(job.Spec.Template.Spec.Containers[0].Env,
+				v1.EnvVar{
+					Name:  env.EndpointsEnvVar,
+					Value: string(endpointsJSON),
+				})
+
+		if meshSchedule != nil {
+			job.Spec.Template.Spec.Containers[0].Env =
+				append(job.Spec.Template.Spec.Containers[0].Env,
+					v1.EnvVar{
+						Name:  env.MeshPeersEnvVar,
+						Value: strings.Join(meshSchedule[nodeName], ","),
+					})
+		}
+
+		job.Spec.Template.Spec.Containers[0].Env =
+			append(job.Spec.Template.Spec.Containers[0].Env,
+				v1.EnvVar{
+					Name:  env.ClockSkewWarnEnvVar,
+					Value: opts.ClockSkew.Warn.String(),
+				},
+				v1.EnvVar{
+					Name:  env.ClockSkewFailEnvVar,
+					Value: opts.ClockSkew.Fail.String(),
+				})
+
+		if throughputTargets != nil && job.Labels[NetworkLabel] == string(NetworkPod) {
+			sort.Strings(throughputSources[nodeName])
+			job.Spec.Template.Spec.Containers[0].Env =
+				append(job.Spec.Template.Spec.Containers[0].Env,
+					v1.EnvVar{
+						Name:  env.ThroughputTargetsEnvVar,
+						Value: strings.Join(throughputTargets[nodeName], ","),
+					},
+					v1.EnvVar{
+						Name:  env.ThroughputSourcesEnvVar,
+						Value: strings.Join(throughputSources[nodeName], ","),
+					},
+					v1.EnvVar{
+						Name:  env.ThroughputDurationEnvVar,
+						Value: opts.ThroughputDuration.String(),
+					})
+			job.Spec.Template.Spec.Containers[0].Ports =
+				append(job.Spec.Template.Spec.Containers[0].Ports,
+					v1.ContainerPort{
+						ContainerPort: ThroughputPort,
+					})
+		}
+
+		if opts.HostInspection {
+			if job.Labels[NetworkLabel] == string(NetworkPod) {
+				addHostInspectionMounts(&job.Spec.Template.Spec, nodes[nodeName])
+			} else {
+				addHostInspectionEnv(&job.Spec.Template.Spec)
+			}
+		}
+
+		if opts.ImagePullSecretName != "" {
 			job.Spec.Template.Spec.ImagePullSecrets = []v1.LocalObjectReference{
 				{
-					Name: imagePullSecretName,
+					Name: opts.ImagePullSecretName,
 				},
 			}
 		}
-		if airgapped {
+		if opts.Airgapped {
 			job.Spec.Template.Spec.Containers[0].Env =
 				append(job.Spec.Template.Spec.Containers[0].Env,
 					v1.EnvVar{
@@ -137,48 +316,174 @@ func TemplateResources(backendFQDN, image, imagePullSecretName,
 					})
 		}
 
-		if imageRegistry != "" {
+		if opts.ImageRegistry != "" {
 			job.Spec.Template.Spec.Containers[0].Env =
 				append(job.Spec.Template.Spec.Containers[0].Env,
 					v1.EnvVar{
 						Name:  env.RegistryEnvVar,
-						Value: imageRegistry,
+						Value: opts.ImageRegistry,
 					})
 		}
 
-		if runaiSaas != "" {
+		if opts.RunAISaas != "" {
 			job.Spec.Template.Spec.Containers[0].Env =
 				append(job.Spec.Template.Spec.Containers[0].Env,
 					v1.EnvVar{
 						Name:  env.RunAISaasEnvVar,
-						Value: runaiSaas,
+						Value: opts.RunAISaas,
+					})
+		}
+
+		if opts.Proxy != "" {
+			for _, name := range []string{env.HTTPProxyEnvVar, env.HTTPProxyEnvVarLower,
+				env.HTTPSProxyEnvVar, env.HTTPSProxyEnvVarLower} {
+				job.Spec.Template.Spec.Containers[0].Env =
+					append(job.Spec.Template.Spec.Containers[0].Env,
+						v1.EnvVar{
+							Name:  name,
+							Value: opts.Proxy,
+						})
+			}
+		}
+
+		if opts.NoProxy != "" {
+			for _, name := range []string{env.NoProxyEnvVar, env.NoProxyEnvVarLower} {
+				job.Spec.Template.Spec.Containers[0].Env =
+					append(job.Spec.Template.Spec.Containers[0].Env,
+						v1.EnvVar{
+							Name:  name,
+							Value: opts.NoProxy,
+						})
+			}
+		}
+
+		if len(opts.CABundle) > 0 {
+			job.Spec.Template.Spec.Volumes = append(job.Spec.Template.Spec.Volumes,
+				v1.Volume{
+					Name: caBundleVolume,
+					VolumeSource: v1.VolumeSource{
+						ConfigMap: &v1.ConfigMapVolumeSource{
+							LocalObjectReference: v1.LocalObjectReference{
+								Name: opts.Names.ForCABundle(),
+							},
+						},
+					},
+				})
+			job.Spec.Template.Spec.Containers[0].VolumeMounts =
+				append(job.Spec.Template.Spec.Containers[0].VolumeMounts,
+					v1.VolumeMount{
+						Name:      caBundleVolume,
+						MountPath: caBundleMountPath,
+						ReadOnly:  true,
+					})
+			job.Spec.Template.Spec.Containers[0].Env =
+				append(job.Spec.Template.Spec.Containers[0].Env,
+					v1.EnvVar{
+						Name:  env.CABundleEnvVar,
+						Value: caBundleMountPath + "/" + caBundleKey,
 					})
 		}
 
-		if image != "" {
-			job.Spec.Template.Spec.Containers[0].Image = image
+		if opts.Image != "" {
+			job.Spec.Template.Spec.Containers[0].Image = opts.Image
+		}
+
+		if opts.ImagePullPolicy != "" {
+			job.Spec.Template.Spec.Containers[0].ImagePullPolicy = opts.ImagePullPolicy
+		}
+
+		job.Spec.Template.Spec.Containers[0].Resources = opts.AgentResources
+		job.Spec.Template.Spec.PriorityClassName = opts.PriorityClassName
+
+		if opts.OpenShift {
+			job.Spec.Template.Annotations = map[string]string{
+				requiredSCCAnnotation: opts.Names.ForRun(),
+			}
 		}
 	}
 
-	creationOrder = append(creationOrder, &Namespace,
-		&ClusterRole, &ClusterRoleBinding,
-		&Role, &RoleBinding,
-		&ServiceAccount)
+	role := templateRole(opts.Names)
+	if opts.OpenShift {
+		role.Rules = append(role.Rules, useSecurityContextConstraintsRule(opts.Names))
+	}
+
+	if !opts.UseExistingNamespace {
+		creationOrder = append(creationOrder, TemplateNamespace(opts.Names, opts.PodSecurityLevel()))
+	}
+
+	if opts.OpenShift {
+		creationOrder = append(creationOrder, templateSecurityContextConstraints(opts.Names, opts.HostNetwork, opts.HostInspection))
+	}
+
+	creationOrder = append(creationOrder,
+		templateClusterRole(opts.Names), templateClusterRoleBinding(opts.Names),
+		role, templateRoleBinding(opts.Names),
+		templateServiceAccount(opts.Names))
+
+	if len(opts.CABundle) > 0 {
+		creationOrder = append(creationOrder, templateCABundleConfigMap(opts.Names, opts.CABundle))
+	}
+
+	creationOrder = append(creationOrder,
+		templateService(opts.Names), templateHeadlessService(opts.Names))
 
 	for _, job := range jobs {
 		creationOrder = append(creationOrder, job)
 	}
 
-	deletionOrder = []client.Object{}
+	return creationOrder
+}
+
+// NamespaceExists is used to validate the namespace before deploying into a
+// pre-created one.
+func NamespaceExists(namespace string) (bool, error) {
+	k8s, err := k8sclient.ClientSet()
+	if err != nil {
+		return false, err
+	}
+
+	_, err = k8s.CoreV1().Namespaces().Get(context.TODO(), namespace, metav1.GetOptions{})
+	if err != nil {
+		if kerrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// PodSecurityLevel returns the Pod Security Admission level the agents
+// comply with.
+func (opts TemplateOptions) PodSecurityLevel() string {
+	if opts.HostNetwork || opts.HostInspection {
+		return podSecurityLevelPrivileged
+	}
+
+	return podSecurityLevelRestricted
+}
+
+// ParseResourceList parses a comma separated list of resource quantities,
+// e.g. "cpu=100m,memory=128Mi".
+func ParseResourceList(list string) (v1.ResourceList, error) {
+	resourceList := v1.ResourceList{}
+	if list == "" {
+		return resourceList, nil
+	}
+
+	for _, item := range strings.Split(list, ",") {
+		name, value, found := strings.Cut(item, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid resource %q, expected <name>=<quantity>", item)
+		}
 
-	for i := len(creationOrder) - 1; i >= 0; i-- {
-		switch creationOrder[i].(type) {
-		case *v1.Namespace:
-			continue
+		quantity, err := resource.ParseQuantity(strings.TrimSpace(value))
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("invalid quantity for resource %s", name))
 		}
 
-		deletionOrder = append(deletionOrder, creationOrder[i])
+		resourceList[v1.ResourceName(strings.TrimSpace(name))] = quantity
 	}
 
-	return creationOrder, deletionOrder
+	return resourceList, nil
 }
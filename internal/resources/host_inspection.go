@@ -0,0 +1,82 @@
+package resources
+
+import (
+	"path"
+	"strings"
+
+	"github.com/run-ai/preinstall-diagnostics/internal/env"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+)
+
+// HostInspectionRoot is where the host directories are mounted into the
+// agents when host inspection is enabled
+const HostInspectionRoot = "/host"
+
+// Host directories mounted read-only for inspection and /dev for the NVIDIA
+// device nodes
+var hostInspectionPaths = []string{"/proc", "/sys", "/etc", "/dev"}
+
+func addHostInspectionMounts(spec *v1.PodSpec, node v1.Node) {
+	for _, hostPath := range hostInspectionPaths {
+		addHostPathMount(spec, hostPath, v1.HostPathDirectory)
+	}
+	for _, hostPath := range hostRuntimePaths(node) {
+		addHostPathMount(spec, hostPath, v1.HostPathDirectory)
+	}
+
+	addHostInspectionEnv(spec)
+}
+
+// hostRuntimePaths returns the root of the container runtime of the node,
+// whose free space is checked, and the containerd configuration of k3s and
+// RKE2. They are told from the runtime and kubelet versions the node reports
+// and mounted rather than /var/lib, which holds the pods' secrets.
+func hostRuntimePaths(node v1.Node) []string {
+	runtime, _, _ := strings.Cut(node.Status.NodeInfo.ContainerRuntimeVersion, "://")
+	kubelet := node.Status.NodeInfo.KubeletVersion
+
+	switch {
+	case runtime == "containerd" && strings.Contains(kubelet, "+k3s"):
+		return []string{"/var/lib/rancher/k3s/agent/containerd", "/var/lib/rancher/k3s/agent/etc/containerd"}
+	case runtime == "containerd" && strings.Contains(kubelet, "+rke2"):
+		return []string{"/var/lib/rancher/rke2/agent/containerd", "/var/lib/rancher/rke2/agent/etc/containerd"}
+	case runtime == "containerd":
+		return []string{"/var/lib/containerd"}
+	case runtime == "cri-o":
+		return []string{"/var/lib/containers"}
+	case runtime == "docker":
+		return []string{"/var/lib/docker"}
+	}
+
+	return nil
+}
+
+// addHostInspectionEnv enables the inspection of the host in the agent, host
+// network agents read the network sysctls of the node without any mount.
+func addHostInspectionEnv(spec *v1.PodSpec) {
+	spec.Containers[0].Env = append(spec.Containers[0].Env, v1.EnvVar{
+		Name:  env.HostInspectionEnvVar,
+		Value: "true",
+	})
+}
+
+func addHostPathMount(spec *v1.PodSpec, hostPath string, hostPathType v1.HostPathType) {
+	volumeName := "host-" + strings.ReplaceAll(strings.TrimPrefix(hostPath, "/"), "/", "-")
+
+	spec.Volumes = append(spec.Volumes, v1.Volume{
+		Name: volumeName,
+		VolumeSource: v1.VolumeSource{
+			HostPath: &v1.HostPathVolumeSource{
+				Path: hostPath,
+				Type: ptr.To(hostPathType),
+			},
+		},
+	})
+
+	spec.Containers[0].VolumeMounts = append(spec.Containers[0].VolumeMounts, v1.VolumeMount{
+		Name:      volumeName,
+		MountPath: path.Join(HostInspectionRoot, hostPath),
+		ReadOnly:  true,
+	})
+}
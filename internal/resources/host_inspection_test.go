@@ -0,0 +1,43 @@
+package resources
+
+import (
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestHostRuntimePaths(t *testing.T) {
+	tests := []struct {
+		runtime string
+		kubelet string
+		want    []string
+	}{
+		{"containerd://1.7.11", "v1.28.5", []string{"/var/lib/containerd"}},
+		{"containerd://1.7.11-k3s2", "v1.28.5+k3s1",
+			[]string{"/var/lib/rancher/k3s/agent/containerd", "/var/lib/rancher/k3s/agent/etc/containerd"}},
+		{"containerd://1.7.11-k3s2", "v1.28.5+rke2r1",
+			[]string{"/var/lib/rancher/rke2/agent/containerd", "/var/lib/rancher/rke2/agent/etc/containerd"}},
+		{"cri-o://1.28.2", "v1.28.5", []string{"/var/lib/containers"}},
+		{"docker://24.0.7", "v1.28.5", []string{"/var/lib/docker"}},
+		{"", "v1.28.5", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.runtime+" "+test.kubelet, func(t *testing.T) {
+			node := v1.Node{
+				Status: v1.NodeStatus{
+					NodeInfo: v1.NodeSystemInfo{
+						ContainerRuntimeVersion: test.runtime,
+						KubeletVersion:          test.kubelet,
+					},
+				},
+			}
+
+			got := hostRuntimePaths(node)
+			if strings.Join(got, ",") != strings.Join(test.want, ",") {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
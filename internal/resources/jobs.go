@@ -5,39 +5,51 @@ import (
 	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
 )
 
 const (
 	RunInternalClusterTestsEnvVarName = "RUN_INTERNAL_CLUSTER_TESTS"
+
+	// Finished jobs are kept long enough for the CLI to collect their state,
+	// and garbage collected afterwards even if the CLI never cleans up
+	jobTTLSecondsAfterFinished = 60 * 60
+
+	// nobody, the agent needs no privileges for the default checks
+	agentUserID = 65534
 )
 
-func TemplateJobsForNodes(nodeNames []string, backendFQDN string) []*batchv1.Job {
+func TemplateJobsForNodes(nodeNames []string, names Names, backendFQDN string, network Network) []*batchv1.Job {
 	jobs := []*batchv1.Job{}
 	for _, nodeName := range nodeNames {
-		jobs = append(jobs, templateJobForNode(nodeName, backendFQDN))
+		jobs = append(jobs, templateJobForNode(nodeName, names, backendFQDN, network))
 	}
 
 	return jobs
 }
 
-func templateJobForNode(nodeName, backendFQDN string) *batchv1.Job {
-	return &batchv1.Job{
+func templateJobForNode(nodeName string, names Names, backendFQDN string, network Network) *batchv1.Job {
+	labels := names.Labels()
+	labels[NetworkLabel] = string(network)
+
+	job := &batchv1.Job{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: batchv1.SchemeGroupVersion.Group + "/" + batchv1.SchemeGroupVersion.Version,
 			Kind:       "Job",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      defaultResourceName + "-" + nodeName,
-			Namespace: Namespace.Name,
-			Labels: map[string]string{
-				defaultResourceName: "",
-			},
+			Name:      names.ForAgent(nodeName, network),
+			Namespace: names.Namespace,
+			Labels:    labels,
 		},
 		Spec: batchv1.JobSpec{
+			TTLSecondsAfterFinished: ptr.To[int32](jobTTLSecondsAfterFinished),
 			Template: v1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels: map[string]string{
-						defaultResourceName: nodeName,
+						AppLabel:     nodeName,
+						RunIDLabel:   names.RunID,
+						NetworkLabel: string(network),
 					},
 				},
 				Spec: v1.PodSpec{
@@ -48,15 +60,30 @@ func templateJobForNode(nodeName, backendFQDN string) *batchv1.Job {
 						},
 					},
 					NodeName:           nodeName,
-					ServiceAccountName: ServiceAccount.Name,
+					ServiceAccountName: names.ForRun(),
+					SecurityContext: &v1.PodSecurityContext{
+						RunAsNonRoot: ptr.To(true),
+						RunAsUser:    ptr.To[int64](agentUserID),
+						RunAsGroup:   ptr.To[int64](agentUserID),
+						SeccompProfile: &v1.SeccompProfile{
+							Type: v1.SeccompProfileTypeRuntimeDefault,
+						},
+					},
 					Containers: []v1.Container{
 						{
-							Name:            defaultResourceName,
+							Name:            names.Prefix,
 							Image:           defaultImage,
-							ImagePullPolicy: v1.PullAlways,
+							ImagePullPolicy: v1.PullIfNotPresent,
+							SecurityContext: &v1.SecurityContext{
+								AllowPrivilegeEscalation: ptr.To(false),
+								ReadOnlyRootFilesystem:   ptr.To(true),
+								Capabilities: &v1.Capabilities{
+									Drop: []v1.Capability{"ALL"},
+								},
+							},
 							Ports: []v1.ContainerPort{
 								{
-									ContainerPort: 8080,
+									ContainerPort: network.AgentPort(),
 								},
 							},
 							Env: []v1.EnvVar{
@@ -68,6 +95,18 @@ func templateJobForNode(nodeName, backendFQDN string) *batchv1.Job {
 									Name:  RunInternalClusterTestsEnvVarName,
 									Value: "true",
 								},
+								{
+									Name:  env.NamePrefixEnvVar,
+									Value: names.Prefix,
+								},
+								{
+									Name:  env.RunIDEnvVar,
+									Value: names.RunID,
+								},
+								{
+									Name:  env.AgentNetworkEnvVar,
+									Value: string(network),
+								},
 								{
 									Name: env.NodeNameEnvVar,
 									ValueFrom: &v1.EnvVarSource{
@@ -84,6 +123,14 @@ func templateJobForNode(nodeName, backendFQDN string) *batchv1.Job {
 										},
 									},
 								},
+								{
+									Name: env.PodIPEnvVar,
+									ValueFrom: &v1.EnvVarSource{
+										FieldRef: &v1.ObjectFieldSelector{
+											FieldPath: "status.podIP",
+										},
+									},
+								},
 								{
 									Name: env.PodNamespaceEnvVar,
 									ValueFrom: &v1.EnvVarSource{
@@ -99,4 +146,12 @@ func templateJobForNode(nodeName, backendFQDN string) *batchv1.Job {
 			},
 		},
 	}
+
+	if network == NetworkHost {
+		job.Spec.Template.Spec.HostNetwork = true
+		// resolve cluster names like the pod network agents do
+		job.Spec.Template.Spec.DNSPolicy = v1.DNSClusterFirstWithHostNet
+	}
+
+	return job
 }
@@ -0,0 +1,200 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/run-ai/preinstall-diagnostics/internal/k8sclient"
+	"github.com/run-ai/preinstall-diagnostics/internal/log"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	lockLeaseDuration = 30 * time.Second
+	lockRenewInterval = 10 * time.Second
+	lockPollInterval  = 5 * time.Second
+)
+
+// RunLock is a Lease held by the active run in the diagnostics namespace, so
+// that two runs never deploy to the same namespace at the same time.
+type RunLock struct {
+	names  Names
+	logger *log.Logger
+	stop   chan struct{}
+}
+
+// ActiveRun returns the ID of the run currently holding the lock, or an
+// empty string when no run is active.
+func ActiveRun(names Names) (string, error) {
+	k8s, err := k8sclient.ClientSet()
+	if err != nil {
+		return "", err
+	}
+
+	lease, err := k8s.CoordinationV1().Leases(names.Namespace).
+		Get(context.TODO(), names.LockName(), metav1.GetOptions{})
+	if err != nil {
+		if kerrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	if leaseExpired(lease) || lease.Spec.HolderIdentity == nil {
+		return "", nil
+	}
+
+	return *lease.Spec.HolderIdentity, nil
+}
+
+// AcquireRunLock takes the lock for the run, waiting up to wait for another
+// active run to finish. The lock is renewed in the background until released,
+// renewal failures are logged.
+func AcquireRunLock(names Names, wait time.Duration, logger *log.Logger) (*RunLock, error) {
+	deadline := time.Now().Add(wait)
+
+	for {
+		holder, err := tryAcquireLock(names)
+		if err != nil {
+			return nil, err
+		}
+
+		if holder == names.RunID {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("another diagnostics run (%s) is active in namespace %s",
+				holder, names.Namespace)
+		}
+
+		time.Sleep(lockPollInterval)
+	}
+
+	l := &RunLock{
+		names:  names,
+		logger: logger,
+		stop:   make(chan struct{}),
+	}
+
+	go l.renew()
+
+	return l, nil
+}
+
+// Release stops renewing the lock and deletes it.
+func (l *RunLock) Release() error {
+	close(l.stop)
+
+	k8s, err := k8sclient.ClientSet()
+	if err != nil {
+		return err
+	}
+
+	err = k8s.CoordinationV1().Leases(l.names.Namespace).
+		Delete(context.TODO(), l.names.LockName(), metav1.DeleteOptions{})
+	if err != nil && !kerrors.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (l *RunLock) renew() {
+	ticker := time.NewTicker(lockRenewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			holder, err := tryAcquireLock(l.names)
+			if err != nil {
+				l.logger.WarningF("could not renew the diagnostics lock: %v", err)
+			} else if holder != l.names.RunID {
+				l.logger.WarningF("the diagnostics lock was taken over by run %s", holder)
+			}
+		}
+	}
+}
+
+// tryAcquireLock creates, takes over or renews the lease on behalf of the run
+// and returns the resulting holder.
+func tryAcquireLock(names Names) (string, error) {
+	k8s, err := k8sclient.ClientSet()
+	if err != nil {
+		return "", err
+	}
+
+	leases := k8s.CoordinationV1().Leases(names.Namespace)
+	now := metav1.NewMicroTime(time.Now())
+
+	lease, err := leases.Get(context.TODO(), names.LockName(), metav1.GetOptions{})
+	if kerrors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      names.LockName(),
+				Namespace: names.Namespace,
+				Labels: map[string]string{
+					AppLabel: "",
+				},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       ptr.To(names.RunID),
+				LeaseDurationSeconds: ptr.To(int32(lockLeaseDuration / time.Second)),
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+
+		_, err = leases.Create(context.TODO(), lease, metav1.CreateOptions{})
+		if kerrors.IsAlreadyExists(err) {
+			return tryAcquireLock(names)
+		}
+		if err != nil {
+			return "", err
+		}
+
+		return names.RunID, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	holder := ptr.Deref(lease.Spec.HolderIdentity, "")
+	if holder != names.RunID && !leaseExpired(lease) {
+		return holder, nil
+	}
+
+	if holder != names.RunID {
+		lease.Spec.AcquireTime = &now
+	}
+	lease.Spec.HolderIdentity = ptr.To(names.RunID)
+	lease.Spec.LeaseDurationSeconds = ptr.To(int32(lockLeaseDuration / time.Second))
+	lease.Spec.RenewTime = &now
+
+	// the update is rejected on conflict, when another run took the lease first
+	_, err = leases.Update(context.TODO(), lease, metav1.UpdateOptions{})
+	if kerrors.IsConflict(err) {
+		return tryAcquireLock(names)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return names.RunID, nil
+}
+
+func leaseExpired(lease *coordinationv1.Lease) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+
+	expiry := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+	return time.Now().After(expiry)
+}
@@ -0,0 +1,138 @@
+package resources
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"hash/fnv"
+
+	"github.com/run-ai/preinstall-diagnostics/internal/env"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// RunIDLabel ties every resource to the run that deployed it, so that
+	// concurrent and leftover runs never pick up each other's resources
+	RunIDLabel = "runai-diagnostics/run-id"
+	// NamespaceLabel and NamePrefixLabel scope the cleanup of stale runs,
+	// cluster-scoped resources included, to the namespace and prefix of the
+	// run cleaning up
+	NamespaceLabel  = "runai-diagnostics/namespace"
+	NamePrefixLabel = "runai-diagnostics/name-prefix"
+
+	// A single lock per namespace, whatever the name prefix, as runs with
+	// different prefixes still share the namespace's stale runs cleanup
+	lockName = "runai-diagnostics-lock"
+
+	runIDBytes = 4
+)
+
+// Names determines where the diagnostics resources are deployed and how they
+// are named, so that customers can follow their own naming conventions.
+type Names struct {
+	Namespace string
+	Prefix    string
+	RunID     string
+}
+
+func DefaultNames() Names {
+	return Names{
+		Namespace: DefaultNamespace,
+		Prefix:    DefaultNamePrefix,
+	}
+}
+
+// NamesFromEnv returns the names the agent was deployed with.
+func NamesFromEnv() Names {
+	return Names{
+		Namespace: env.EnvOrDefault(env.PodNamespaceEnvVar, DefaultNamespace),
+		Prefix:    env.EnvOrDefault(env.NamePrefixEnvVar, DefaultNamePrefix),
+		RunID:     env.EnvOrDefault(env.RunIDEnvVar, ""),
+	}
+}
+
+func NewRunID() string {
+	b := make([]byte, runIDBytes)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// ForRun returns the name of the resources shared by all agents of the run.
+func (n Names) ForRun() string {
+	return n.withRunID(n.Prefix)
+}
+
+// ForNode returns the name of the per-node job and of the ConfigMap the
+// node's agent reports its results to.
+func (n Names) ForNode(nodeName string) string {
+	return n.withRunID(n.Prefix + "-" + nodeName)
+}
+
+// ForCABundle returns the name of the ConfigMap holding the custom CA bundle.
+func (n Names) ForCABundle() string {
+	return n.withRunID(n.Prefix + "-ca-bundle")
+}
+
+// ForHeadlessService returns the name of the headless Service resolving to
+// the agents of the run.
+func (n Names) ForHeadlessService() string {
+	return n.withRunID(n.Prefix + "-headless")
+}
+
+// LockName returns the name of the Lease held by the active run.
+func (n Names) LockName() string {
+	return lockName
+}
+
+// Labels returns the labels of every resource deployed by the run.
+func (n Names) Labels() map[string]string {
+	l := map[string]string{
+		AppLabel:        "",
+		NamespaceLabel:  n.Namespace,
+		NamePrefixLabel: n.Prefix,
+	}
+	if n.RunID != "" {
+		l[RunIDLabel] = n.RunID
+	}
+
+	return l
+}
+
+// RunSelector selects the resources deployed by the run.
+func (n Names) RunSelector() string {
+	selector := AppLabel
+	if n.RunID != "" {
+		selector += "," + labels.FormatLabels(map[string]string{RunIDLabel: n.RunID})
+	}
+
+	return selector
+}
+
+// ScopeSelector selects the resources deployed by all runs with the same
+// namespace and name prefix.
+func (n Names) ScopeSelector() string {
+	return AppLabel + "," + labels.FormatLabels(map[string]string{
+		NamespaceLabel:  n.Namespace,
+		NamePrefixLabel: n.Prefix,
+	})
+}
+
+// Seed derives a seed from the run ID, so that random choices made for a run
+// can be reproduced.
+func (n Names) Seed() int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(n.RunID))
+
+	return int64(h.Sum64())
+}
+
+func (n Names) withRunID(name string) string {
+	if n.RunID == "" {
+		return name
+	}
+
+	return name + "-" + n.RunID
+}
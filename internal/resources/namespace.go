@@ -5,15 +5,29 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-var Namespace = v1.Namespace{
-	TypeMeta: metav1.TypeMeta{
-		APIVersion: coreAPIVersion,
-		Kind:       "Namespace",
-	},
-	ObjectMeta: metav1.ObjectMeta{
-		Name: defaultResourceName,
-		Labels: map[string]string{
-			defaultResourceName: "",
+const (
+	podSecurityEnforceLabel = "pod-security.kubernetes.io/enforce"
+	podSecurityWarnLabel    = "pod-security.kubernetes.io/warn"
+
+	podSecurityLevelRestricted = "restricted"
+	// Required by host network agents and hostPath volumes, even the baseline
+	// level forbids them
+	podSecurityLevelPrivileged = "privileged"
+)
+
+func TemplateNamespace(names Names, podSecurityLevel string) *v1.Namespace {
+	return &v1.Namespace{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: coreAPIVersion,
+			Kind:       "Namespace",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: names.Namespace,
+			Labels: map[string]string{
+				AppLabel:                "",
+				podSecurityEnforceLabel: podSecurityLevel,
+				podSecurityWarnLabel:    podSecurityLevel,
+			},
 		},
-	},
+	}
 }
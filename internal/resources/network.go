@@ -0,0 +1,60 @@
+package resources
+
+import (
+	"github.com/run-ai/preinstall-diagnostics/internal/env"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Network is the network an agent runs on.
+type Network string
+
+const (
+	NetworkPod  Network = "pod"
+	NetworkHost Network = "host"
+
+	// NetworkLabel tells apart the agents of the run running on the pod
+	// network from those running on the host network
+	NetworkLabel = "runai-diagnostics/network"
+
+	// AgentPort is served by every pod network agent, for the other agents to
+	// ping
+	AgentPort = 8080
+	// HostNetworkAgentPort is served on the nodes by the host network agents,
+	// chosen to be less likely to be taken than AgentPort
+	HostNetworkAgentPort = 18080
+	// ThroughputPort receives the throughput tests of the pod network agents
+	ThroughputPort = 8081
+)
+
+// NetworkFromEnv returns the network the agent was deployed to.
+func NetworkFromEnv() Network {
+	if Network(env.EnvOrDefault(env.AgentNetworkEnvVar, "")) == NetworkHost {
+		return NetworkHost
+	}
+
+	return NetworkPod
+}
+
+// AgentPort returns the port the agents of the network serve.
+func (n Network) AgentPort() int32 {
+	if n == NetworkHost {
+		return HostNetworkAgentPort
+	}
+
+	return AgentPort
+}
+
+// ForAgent returns the name of the job of the agent running on the node and
+// network, and of the ConfigMap the agent reports its results to.
+func (n Names) ForAgent(nodeName string, network Network) string {
+	if network == NetworkHost {
+		return n.withRunID(n.Prefix + "-host-" + nodeName)
+	}
+
+	return n.ForNode(nodeName)
+}
+
+// AgentSelector selects the agents of the run running on the network.
+func (n Names) AgentSelector(network Network) string {
+	return n.RunSelector() + "," + labels.FormatLabels(map[string]string{NetworkLabel: string(network)})
+}
@@ -5,32 +5,32 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-var Role = rbacv1.ClusterRole{
-	TypeMeta: metav1.TypeMeta{
-		APIVersion: rbacGV,
-		Kind:       "Role",
-	},
-	ObjectMeta: metav1.ObjectMeta{
-		Name:      defaultResourceName,
-		Namespace: defaultResourceName,
-		Labels: map[string]string{
-			defaultResourceName: "",
+func templateRole(names Names) *rbacv1.Role {
+	return &rbacv1.Role{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: rbacGV,
+			Kind:       "Role",
 		},
-	},
-	Rules: []rbacv1.PolicyRule{
-		{
-			APIGroups: []string{
-				"",
-			},
-			Resources: []string{
-				"configmaps",
-			},
-			Verbs: []string{
-				"get",
-				"list",
-				"create",
-				"delete",
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      names.ForRun(),
+			Namespace: names.Namespace,
+			Labels:    names.Labels(),
+		},
+		Rules: []rbacv1.PolicyRule{
+			{
+				APIGroups: []string{
+					"",
+				},
+				Resources: []string{
+					"configmaps",
+				},
+				Verbs: []string{
+					"get",
+					"list",
+					"create",
+					"delete",
+				},
 			},
 		},
-	},
+	}
 }
@@ -5,28 +5,28 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-var RoleBinding = rbacv1.ClusterRoleBinding{
-	TypeMeta: metav1.TypeMeta{
-		APIVersion: rbacGV,
-		Kind:       "RoleBinding",
-	},
-	ObjectMeta: metav1.ObjectMeta{
-		Name:      defaultResourceName,
-		Namespace: defaultResourceName,
-		Labels: map[string]string{
-			defaultResourceName: "",
+func templateRoleBinding(names Names) *rbacv1.RoleBinding {
+	return &rbacv1.RoleBinding{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: rbacGV,
+			Kind:       "RoleBinding",
 		},
-	},
-	RoleRef: rbacv1.RoleRef{
-		APIGroup: rbacAPIGroup,
-		Kind:     Role.Kind,
-		Name:     Role.Name,
-	},
-	Subjects: []rbacv1.Subject{
-		{
-			Kind:      ServiceAccount.Kind,
-			Name:      ServiceAccount.Name,
-			Namespace: ServiceAccount.Namespace,
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      names.ForRun(),
+			Namespace: names.Namespace,
+			Labels:    names.Labels(),
 		},
-	},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacAPIGroup,
+			Kind:     "Role",
+			Name:     names.ForRun(),
+		},
+		Subjects: []rbacv1.Subject{
+			{
+				Kind:      rbacv1.ServiceAccountKind,
+				Name:      names.ForRun(),
+				Namespace: names.Namespace,
+			},
+		},
+	}
 }
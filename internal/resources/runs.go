@@ -0,0 +1,118 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/utils/ptr"
+)
+
+type runScopedResource struct {
+	gvr        schema.GroupVersionResource
+	namespaced bool
+}
+
+// Every kind of resource that is deployed per run, in deletion order
+var runScopedResources = []runScopedResource{
+	{gvr: schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "jobs"}, namespaced: true},
+	{gvr: schema.GroupVersionResource{Version: "v1", Resource: "services"}, namespaced: true},
+	{gvr: schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}, namespaced: true},
+	{gvr: schema.GroupVersionResource{Version: "v1", Resource: "serviceaccounts"}, namespaced: true},
+	{gvr: schema.GroupVersionResource{Group: rbacAPIGroup, Version: rbacAPIVersion, Resource: "rolebindings"}, namespaced: true},
+	{gvr: schema.GroupVersionResource{Group: rbacAPIGroup, Version: rbacAPIVersion, Resource: "roles"}, namespaced: true},
+	{gvr: schema.GroupVersionResource{Group: rbacAPIGroup, Version: rbacAPIVersion, Resource: "clusterrolebindings"}},
+	{gvr: schema.GroupVersionResource{Group: rbacAPIGroup, Version: rbacAPIVersion, Resource: "clusterroles"}},
+	{gvr: schema.GroupVersionResource{Group: securityAPIGroup, Version: securityAPIVersion, Resource: "securitycontextconstraints"}},
+}
+
+// DeleteRun deletes all resources deployed by the run, including the results
+// reported by its agents.
+func DeleteRun(names Names, kubeDynamicClient dynamic.Interface) error {
+	_, err := deleteRunScopedResources(names.Namespace, []string{names.RunSelector()}, kubeDynamicClient,
+		func(string, time.Time) bool { return true })
+	return err
+}
+
+// DeleteStaleRuns deletes the resources of every run with the same namespace
+// and name prefix created more than ttl ago, except for the run identified by
+// activeRunID and the run holding the namespace's lock. Resources deployed
+// before run IDs were introduced are treated as belonging to a stale run.
+// The IDs of the deleted runs are returned.
+func DeleteStaleRuns(names Names, ttl time.Duration, activeRunID string,
+	kubeDynamicClient dynamic.Interface) ([]string, error) {
+	lockHolder, err := ActiveRun(names)
+	if err != nil {
+		return nil, err
+	}
+
+	selectors := []string{
+		names.ScopeSelector(),
+		// resources of previous versions of the tool
+		AppLabel + ",!" + RunIDLabel,
+	}
+
+	return deleteRunScopedResources(names.Namespace, selectors, kubeDynamicClient,
+		func(runID string, created time.Time) bool {
+			if runID != "" && (runID == activeRunID || runID == lockHolder) {
+				return false
+			}
+
+			return time.Since(created) >= ttl
+		})
+}
+
+func deleteRunScopedResources(namespace string, labelSelectors []string, kubeDynamicClient dynamic.Interface,
+	shouldDelete func(runID string, created time.Time) bool) ([]string, error) {
+	deletedRuns := map[string]struct{}{}
+
+	for _, res := range runScopedResources {
+		var ri dynamic.ResourceInterface = kubeDynamicClient.Resource(res.gvr)
+		if res.namespaced {
+			ri = kubeDynamicClient.Resource(res.gvr).Namespace(namespace)
+		}
+
+		for _, labelSelector := range labelSelectors {
+			list, err := ri.List(context.TODO(), metav1.ListOptions{
+				LabelSelector: labelSelector,
+			})
+			// not every resource is served by every cluster, e.g. SCCs exist on OpenShift only
+			if kerrors.IsNotFound(err) {
+				break
+			}
+			if err != nil {
+				return nil, errors.Wrap(err,
+					fmt.Sprintf("list error: resource: %s", res.gvr.Resource))
+			}
+
+			for _, obj := range list.Items {
+				runID := obj.GetLabels()[RunIDLabel]
+				if !shouldDelete(runID, obj.GetCreationTimestamp().Time) {
+					continue
+				}
+
+				err := ri.Delete(context.TODO(), obj.GetName(), metav1.DeleteOptions{
+					PropagationPolicy: ptr.To(metav1.DeletePropagationBackground),
+				})
+				if err != nil && !kerrors.IsNotFound(err) {
+					return nil, errors.Wrap(err,
+						fmt.Sprintf("delete error: resource: %s", res.gvr.Resource))
+				}
+
+				deletedRuns[runID] = struct{}{}
+			}
+		}
+	}
+
+	runIDs := []string{}
+	for runID := range deletedRuns {
+		runIDs = append(runIDs, runID)
+	}
+
+	return runIDs, nil
+}
@@ -0,0 +1,87 @@
+package resources
+
+import (
+	securityv1 "github.com/openshift/api/security/v1"
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	securityAPIGroup   = "security.openshift.io"
+	securityAPIVersion = "v1"
+	securityGV         = securityAPIGroup + "/" + securityAPIVersion
+
+	// Requests a specific SCC for the pod, honoured by OpenShift 4.14 and later
+	requiredSCCAnnotation = "openshift.io/required-scc"
+)
+
+// templateSecurityContextConstraints allows the agents to run with the user
+// and seccomp profile set in their pod spec, which the default restricted SCC
+// rejects as it assigns UIDs from the namespace range. The host network and
+// hostPath volumes are allowed only when the agents use them.
+func templateSecurityContextConstraints(names Names, hostNetwork, hostPath bool) *securityv1.SecurityContextConstraints {
+	scc := &securityv1.SecurityContextConstraints{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: securityGV,
+			Kind:       "SecurityContextConstraints",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   names.ForRun(),
+			Labels: names.Labels(),
+		},
+		Priority:                 ptr.To[int32](0),
+		AllowPrivilegedContainer: false,
+		AllowHostNetwork:         hostNetwork,
+		AllowHostPorts:           hostNetwork,
+		AllowHostDirVolumePlugin: hostPath,
+		AllowPrivilegeEscalation: ptr.To(false),
+		RequiredDropCapabilities: []v1.Capability{"ALL"},
+		Volumes: []securityv1.FSType{
+			securityv1.FSTypeConfigMap,
+			securityv1.FSTypeDownwardAPI,
+			securityv1.FSTypeEmptyDir,
+			securityv1.FSProjected,
+			securityv1.FSTypeSecret,
+		},
+		SELinuxContext: securityv1.SELinuxContextStrategyOptions{
+			Type: securityv1.SELinuxStrategyMustRunAs,
+		},
+		RunAsUser: securityv1.RunAsUserStrategyOptions{
+			Type: securityv1.RunAsUserStrategyMustRunAsNonRoot,
+		},
+		SupplementalGroups: securityv1.SupplementalGroupsStrategyOptions{
+			Type: securityv1.SupplementalGroupsStrategyRunAsAny,
+		},
+		FSGroup: securityv1.FSGroupStrategyOptions{
+			Type: securityv1.FSGroupStrategyRunAsAny,
+		},
+		SeccompProfiles: []string{
+			"runtime/default",
+		},
+	}
+
+	if hostPath {
+		scc.Volumes = append(scc.Volumes, securityv1.FSTypeHostPath)
+	}
+
+	return scc
+}
+
+func useSecurityContextConstraintsRule(names Names) rbacv1.PolicyRule {
+	return rbacv1.PolicyRule{
+		APIGroups: []string{
+			securityAPIGroup,
+		},
+		Resources: []string{
+			"securitycontextconstraints",
+		},
+		ResourceNames: []string{
+			names.ForRun(),
+		},
+		Verbs: []string{
+			"use",
+		},
+	}
+}
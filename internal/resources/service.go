@@ -0,0 +1,46 @@
+package resources
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// templateService fronts the agents of the run with a ClusterIP, to check
+// that kube-proxy routes service traffic on every node.
+func templateService(names Names) *v1.Service {
+	return &v1.Service{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: coreAPIVersion,
+			Kind:       "Service",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      names.ForRun(),
+			Namespace: names.Namespace,
+			Labels:    names.Labels(),
+		},
+		Spec: v1.ServiceSpec{
+			Selector: map[string]string{
+				RunIDLabel:   names.RunID,
+				NetworkLabel: string(NetworkPod),
+			},
+			Ports: []v1.ServicePort{
+				{
+					Name:       "http",
+					Port:       AgentPort,
+					TargetPort: intstr.FromInt32(AgentPort),
+				},
+			},
+		},
+	}
+}
+
+// templateHeadlessService resolves to the addresses of the agents of the run,
+// to check that the cluster DNS serves endpoints on every node.
+func templateHeadlessService(names Names) *v1.Service {
+	service := templateService(names)
+	service.Name = names.ForHeadlessService()
+	service.Spec.ClusterIP = v1.ClusterIPNone
+
+	return service
+}
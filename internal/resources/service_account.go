@@ -5,16 +5,16 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-var ServiceAccount = v1.ServiceAccount{
-	TypeMeta: metav1.TypeMeta{
-		APIVersion: coreAPIVersion,
-		Kind:       "ServiceAccount",
-	},
-	ObjectMeta: metav1.ObjectMeta{
-		Name:      defaultResourceName,
-		Namespace: Namespace.Name,
-		Labels: map[string]string{
-			defaultResourceName: "",
+func templateServiceAccount(names Names) *v1.ServiceAccount {
+	return &v1.ServiceAccount{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: coreAPIVersion,
+			Kind:       "ServiceAccount",
 		},
-	},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      names.ForRun(),
+			Namespace: names.Namespace,
+			Labels:    names.Labels(),
+		},
+	}
 }
@@ -1,7 +1,18 @@
 package internal
 
+// DNSConfigMapKey is the key of the agent's results ConfigMap holding the
+// answer of the node's resolver for the backend FQDN.
+const DNSConfigMapKey = "dns"
+
 type TestResult struct {
 	Name    string `json:"name,omitempty"`
 	Result  bool   `json:"result,omitempty"`
 	Message string `json:"message,omitempty"`
 }
+
+// DNSAnswer is the answer of a resolver for a name.
+type DNSAnswer struct {
+	Name  string   `json:"name"`
+	IPs   []string `json:"ips,omitempty"`
+	Error string   `json:"error,omitempty"`
+}
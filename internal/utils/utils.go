@@ -3,32 +3,31 @@ package utils
 import (
 	"context"
 	"fmt"
-	"net/http"
 	"time"
 
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/run-ai/preinstall-diagnostics/internal/k8sclient"
 	"github.com/run-ai/preinstall-diagnostics/internal/log"
+	"github.com/run-ai/preinstall-diagnostics/internal/progress"
 	"github.com/run-ai/preinstall-diagnostics/internal/resources"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-func CheckURLAvailable(url string) (bool, error) {
-	res, err := http.Get(url)
-	if err != nil {
-		return false, err
-	} else {
-		if res.StatusCode >= 400 && res.StatusCode < 200 {
-			return false, fmt.Errorf("%s is not reachable, got status code %d", url, res.StatusCode)
-		}
-	}
-
-	return true, nil
-}
+const (
+	// Set on job pods by all supported Kubernetes versions, unlike the
+	// batch.kubernetes.io prefixed label introduced in 1.27
+	legacyJobNameLabel = "job-name"
+)
 
-func WaitForJobsToComplete(interval, timeout time.Duration) error {
+// WaitForJobsToComplete waits for every agent job of the run to complete or
+// fail, the nodes of failed jobs are reported without results.
+func WaitForJobsToComplete(names resources.Names, interval, timeout time.Duration,
+	onUpdate func(progress.AgentCounts)) error {
 	k8s, err := k8sclient.ClientSet()
 	if err != nil {
 		return err
@@ -37,20 +36,24 @@ func WaitForJobsToComplete(interval, timeout time.Duration) error {
 	for ; timeout > 0; timeout -= interval {
 		time.Sleep(interval)
 
-		jobs, err := k8s.BatchV1().Jobs("runai-diagnostics").List(context.TODO(),
-			metav1.ListOptions{})
+		jobs, err := k8s.BatchV1().Jobs(names.Namespace).List(context.TODO(),
+			metav1.ListOptions{
+				LabelSelector: names.RunSelector(),
+			})
 		if err != nil {
 			return err
 		}
 
-		completedJobs := 0
-		for _, job := range jobs.Items {
-			if job.Status.CompletionTime != nil {
-				completedJobs++
-			}
+		counts, err := agentCounts(k8s, names, jobs.Items)
+		if err != nil {
+			return err
 		}
 
-		if completedJobs == len(jobs.Items) {
+		if onUpdate != nil {
+			onUpdate(counts)
+		}
+
+		if counts.Completed+counts.Failed == len(jobs.Items) {
 			return nil
 		}
 	}
@@ -58,6 +61,73 @@ func WaitForJobsToComplete(interval, timeout time.Duration) error {
 	return fmt.Errorf("timed out waiting for jobs to be completed")
 }
 
+// agentCounts classifies every diagnostics job by the furthest state its agent
+// has reached: scheduled (pod not running yet), running, reporting (results
+// ConfigMap written), completed or failed.
+func agentCounts(k8s *kubernetes.Clientset, names resources.Names, jobs []batchv1.Job) (progress.AgentCounts, error) {
+	counts := progress.AgentCounts{
+		Total: len(jobs),
+	}
+
+	pods, err := k8s.CoreV1().Pods(names.Namespace).List(context.TODO(),
+		metav1.ListOptions{
+			LabelSelector: names.RunSelector(),
+		})
+	if err != nil {
+		return counts, err
+	}
+
+	runningJobs := map[string]struct{}{}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == v1.PodRunning {
+			runningJobs[pod.Labels[legacyJobNameLabel]] = struct{}{}
+		}
+	}
+
+	cms, err := k8s.CoreV1().ConfigMaps(names.Namespace).List(context.TODO(),
+		metav1.ListOptions{
+			LabelSelector: names.RunSelector(),
+		})
+	if err != nil {
+		return counts, err
+	}
+
+	reportedJobs := map[string]struct{}{}
+	for _, cm := range cms.Items {
+		reportedJobs[cm.Name] = struct{}{}
+	}
+
+	for _, job := range jobs {
+		_, running := runningJobs[job.Name]
+		_, reported := reportedJobs[job.Name]
+
+		switch {
+		case job.Status.CompletionTime != nil:
+			counts.Completed++
+		case jobFailed(&job):
+			counts.Failed++
+		case reported:
+			counts.Reporting++
+		case running:
+			counts.Running++
+		default:
+			counts.Scheduled++
+		}
+	}
+
+	return counts, nil
+}
+
+func jobFailed(job *batchv1.Job) bool {
+	for _, cond := range job.Status.Conditions {
+		if cond.Type == batchv1.JobFailed && cond.Status == v1.ConditionTrue {
+			return true
+		}
+	}
+
+	return false
+}
+
 func AppendRowToTable(t table.Writer, testName string, testResult bool, testMessage string) {
 	testResultStr := func() string {
 		if testResult {
@@ -69,8 +139,8 @@ func AppendRowToTable(t table.Writer, testName string, testResult bool, testMess
 	t.AppendRow(table.Row{testName, testResultStr(), testMessage})
 }
 
-func DeleteResources(resourcesToDelete []client.Object, dynClient dynamic.Interface, logger *log.Logger) error {
-	err := resources.DeleteResources(resourcesToDelete, dynClient)
+func DeleteRun(names resources.Names, dynClient dynamic.Interface, logger *log.Logger) error {
+	err := resources.DeleteRun(names, dynClient)
 	if err != nil {
 		return err
 	}
@@ -79,6 +149,24 @@ func DeleteResources(resourcesToDelete []client.Object, dynClient dynamic.Interf
 	return nil
 }
 
+func DeleteStaleRuns(names resources.Names, ttl time.Duration, activeRunID string,
+	dynClient dynamic.Interface, logger *log.Logger) error {
+	runIDs, err := resources.DeleteStaleRuns(names, ttl, activeRunID, dynClient)
+	if err != nil {
+		return err
+	}
+
+	for _, runID := range runIDs {
+		if runID == "" {
+			logger.WriteStringF("deleted resources of a previous version of the tool")
+			continue
+		}
+		logger.WriteStringF("deleted resources of stale run %s", runID)
+	}
+
+	return nil
+}
+
 func CreateResources(resourcesToCreate []client.Object, dynClient dynamic.Interface) error {
 	return resources.CreateResources(resourcesToCreate, dynClient)
 }